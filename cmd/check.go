@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"weather/internal/database"
+	"weather/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// check is one step of "config check"; it returns a short detail on success.
+type check struct {
+	name string
+	run  func() (string, error)
+}
+
+// runConfig handles "config check", which validates the configuration
+// and reaches the database without changing anything. Secrets are never
+// printed.
+func runConfig(args []string) error {
+	flags := newFlagSet("config check", "")
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("expected check")
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	checks := []check{
+		{"public base URL", checkPublicBaseURL},
+		{"token secret", checkTokenSecret},
+		{"email encryption", checkEncryption},
+		{"mail templates", checkTemplates},
+		{"mail transport", checkTransport},
+		{"database", checkDatabase},
+	}
+
+	failed := 0
+	for _, c := range checks {
+		detail, err := c.run()
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", c.name, err)
+			continue
+		}
+		fmt.Printf("ok    %s: %s\n", c.name, detail)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+
+	return nil
+}
+
+// checkPublicBaseURL also rejects loopback hosts in release mode, where
+// links in emails must reach subscribers.
+func checkPublicBaseURL() (string, error) {
+	appConfig := getApplicationConfig()
+	publicBaseURL := appConfig.PublicBaseURL
+	if publicBaseURL == "" {
+		return "", errNoPublicBaseURL
+	}
+
+	u, err := url.Parse(publicBaseURL)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.Errorf("%q is not an absolute http(s) URL", publicBaseURL)
+	}
+	if appConfig.Mode == gin.ReleaseMode && isLoopback(u.Hostname()) {
+		return "", errors.Errorf("%q points at this machine, which subscribers can't reach", publicBaseURL)
+	}
+
+	return publicBaseURL, nil
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsUnspecified())
+}
+
+func checkTokenSecret() (string, error) {
+	if _, err := newSigner(); err != nil {
+		return "", err
+	}
+
+	return "set", nil
+}
+
+func checkEncryption() (string, error) {
+	encryptionConfig := getEncryptionConfig()
+
+	keyring, err := newKeyring(encryptionConfig)
+	if err != nil {
+		return "", err
+	}
+	if encryptionConfig.BatchSize <= 0 {
+		return "", errors.Errorf("EMAIL_REENCRYPT_BATCH_SIZE must be positive, got %d", encryptionConfig.BatchSize)
+	}
+
+	return fmt.Sprintf("encrypting with key %q", keyring.KeyID()), nil
+}
+
+func checkTemplates() (string, error) {
+	if _, err := mailer.NewRenderer(getMailTemplatesDir()); err != nil {
+		return "", err
+	}
+
+	if dir := getMailTemplatesDir(); dir != "" {
+		return "embedded, overridden from " + dir, nil
+	}
+
+	return "embedded", nil
+}
+
+// checkTransport only builds the transport; `mail test` sends an email.
+func checkTransport() (string, error) {
+	transportConfig := getMailTransportConfig()
+
+	transport, err := mailer.NewTransport(transportConfig, getSMTPConfig())
+	if err != nil {
+		return "", err
+	}
+
+	return transportConfig.Kind, transport.Close()
+}
+
+func checkDatabase() (string, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return "", err
+	}
+	defer closeDatabase(db)
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), MigrateTimeoutDuration)
+	defer cancel()
+
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := status.Check(); err != nil {
+		return "", err
+	}
+
+	detail := fmt.Sprintf("connected, schema version %d of %d", status.Version, status.Latest)
+	if len(status.Pending) > 0 {
+		detail += fmt.Sprintf(", %d migrations pending until the next start", len(status.Pending))
+	}
+
+	return detail, nil
+}
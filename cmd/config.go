@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"weather/internal/config"
+	"weather/internal/env"
+	"weather/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getDatabaseConfig() config.DBConfig {
+	dbName := env.GetString("DB_NAME", "weather")
+	dbPassword := env.GetString("DB_PASSWORD", "")
+	dbUser := env.GetString("DB_USER", "postgres")
+	dbHost := env.GetString("DB_HOST", "localhost")
+	dbPort := env.GetInt("DB_PORT", 5432)
+	dbSSL := env.GetString("DB_SSL_MODE", "")
+
+	dbAddr := fmt.Sprintf(
+		"user=%s password=%s host=%s port=%d dbname=%s sslmode=%s",
+		dbUser,
+		dbPassword,
+		dbHost,
+		dbPort,
+		dbName,
+		dbSSL,
+	)
+
+	return config.DBConfig{
+		Addr:         dbAddr,
+		MaxOpenConns: env.GetInt("MAX_OPEN_CONNS", 30),
+		MaxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 30),
+		MaxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
+	}
+}
+
+func getApplicationConfig() config.ApplicationConfig {
+	appPort := env.GetInt("APP_PORT", 8080)
+	readTimeoutDuration := time.Duration(env.GetInt("READ_TIMEOUT", 5)) * time.Second
+	writeTimeoutDuration := time.Duration(env.GetInt("WRITE_TIMEOUT", 5)) * time.Second
+	idleTimeoutDuration := time.Duration(env.GetInt("IDLE_TIMEOUT", 5)) * time.Second
+	mode := env.GetString("GIN_MODE", gin.ReleaseMode)
+	if mode == "" {
+		mode = gin.ReleaseMode
+	}
+	// docker-compose passes unset variables as empty strings. Release mode
+	// has no default, as links in emails would point at localhost.
+	publicBaseURL := env.GetString("PUBLIC_BASE_URL", "")
+	if publicBaseURL == "" && mode != gin.ReleaseMode {
+		publicBaseURL = fmt.Sprintf("http://localhost:%d", appPort)
+	}
+
+	return config.ApplicationConfig{
+		Mode:          mode,
+		Addr:          fmt.Sprintf(":%d", appPort),
+		PublicBaseURL: publicBaseURL,
+		ReadTimeout:   readTimeoutDuration,
+		WriteTimeout:  writeTimeoutDuration,
+		IdleTimeout:   idleTimeoutDuration,
+	}
+}
+
+func getWeatherAPIConfig() config.WeatherAPIConfig {
+	weatherServiceURL := env.GetString("WEATHER_SERVICE_URL", "http://api.weatherapi.com/v1/current.json")
+	weatherAPIKey := env.GetString("WEATHER_API_KEY", "fake-api-key")
+	weatherCacheTTL := env.GetDuration("WEATHER_CACHE_TTL", 10*time.Minute)
+	// Weather pre-warmed before a mailing must still be cached when it starts.
+	if minTTL := 2 * mailer.PrewarmLead; weatherCacheTTL < minTTL {
+		log.Printf("WEATHER_CACHE_TTL %s doesn't outlast the mailer pre-warm lead %s, using %s\n",
+			weatherCacheTTL, mailer.PrewarmLead, minTTL)
+		weatherCacheTTL = minTTL
+	}
+
+	return config.WeatherAPIConfig{
+		ServiceBaseURL: weatherServiceURL,
+		APIKey:         weatherAPIKey,
+		CacheTTL:       weatherCacheTTL,
+	}
+}
+
+func getSMTPConfig() config.SMTPConfig {
+	smtpUser := env.GetString("SMTP_USER", "email")
+	smtpPassword := env.GetString("SMTP_PASS", "smash")
+	smtpHost := env.GetString("SMTP_HOST", "host")
+	smtpPort := env.GetString("SMTP_PORT", "port")
+
+	return config.SMTPConfig{
+		SMTPUser:           smtpUser,
+		SMTPPassword:       smtpPassword,
+		SMTPHost:           smtpHost,
+		SMTPPort:           smtpPort,
+		Security:           env.GetString("SMTP_SECURITY", "implicit-tls"),
+		AuthMechanism:      env.GetString("SMTP_AUTH", "plain"),
+		EnvelopeFrom:       env.GetString("SMTP_ENVELOPE_FROM", ""),
+		FromAddress:        env.GetString("SMTP_FROM", smtpUser),
+		FromName:           env.GetString("SMTP_FROM_NAME", ""),
+		PoolSize:           env.GetInt("SMTP_POOL_SIZE", 5),
+		IdleTimeout:        env.GetDuration("SMTP_IDLE_TIMEOUT", 30*time.Second),
+		MaxMessagesPerConn: env.GetInt("SMTP_MAX_MESSAGES_PER_CONN", 100),
+	}
+}
+
+func getSubscriptionConfig() config.SubscriptionConfig {
+	return config.SubscriptionConfig{
+		ConfirmationTTL: env.GetDuration("CONFIRMATION_TTL", 48*time.Hour),
+		TokenSecret:     env.GetString("TOKEN_SECRET", ""),
+		JanitorInterval: env.GetDuration("JANITOR_INTERVAL", 10*time.Minute),
+		ReminderBefore:  env.GetDuration("CONFIRMATION_REMINDER_BEFORE", 0),
+		ResendInterval:  env.GetDuration("CONFIRMATION_RESEND_INTERVAL", time.Minute),
+	}
+}
+
+func getManageConfig(publicBaseURL string) config.ManageConfig {
+	return config.ManageConfig{
+		LinkTTL:      env.GetDuration("MANAGE_LINK_TTL", 15*time.Minute),
+		SessionTTL:   env.GetDuration("MANAGE_SESSION_TTL", time.Hour),
+		LinkInterval: env.GetDuration("MANAGE_LINK_INTERVAL", time.Minute),
+		SecureCookie: strings.HasPrefix(publicBaseURL, "https://"),
+	}
+}
+
+func getMailerConfig() config.MailerConfig {
+	return config.MailerConfig{
+		Workers:   env.GetInt("MAILER_WORKERS", 10),
+		QueueSize: env.GetInt("MAILER_QUEUE_SIZE", 100),
+	}
+}
+
+func getMailTransportConfig() config.MailTransportConfig {
+	return config.MailTransportConfig{
+		Kind: env.GetString("MAIL_TRANSPORT", "smtp"),
+		HTTP: config.HTTPTransportConfig{
+			URL:     env.GetString("MAIL_HTTP_URL", ""),
+			APIKey:  env.GetString("MAIL_HTTP_API_KEY", ""),
+			Timeout: env.GetDuration("MAIL_HTTP_TIMEOUT", 10*time.Second),
+		},
+		File: config.FileTransportConfig{
+			Format: env.GetString("MAIL_FILE_FORMAT", "maildir"),
+			Path:   env.GetString("MAIL_FILE_PATH", "./mail"),
+		},
+		SandboxCapacity: env.GetInt("MAIL_SANDBOX_CAPACITY", 100),
+	}
+}
+
+func getOutboxConfig() config.OutboxConfig {
+	return config.OutboxConfig{
+		PollInterval:  env.GetDuration("OUTBOX_POLL_INTERVAL", 5*time.Second),
+		BatchSize:     env.GetInt("OUTBOX_BATCH_SIZE", 100),
+		Lease:         env.GetDuration("OUTBOX_LEASE", 5*time.Minute),
+		MaxAttempts:   env.GetInt("OUTBOX_MAX_ATTEMPTS", 8),
+		BaseBackoff:   env.GetDuration("OUTBOX_BASE_BACKOFF", 30*time.Second),
+		MaxBackoff:    env.GetDuration("OUTBOX_MAX_BACKOFF", time.Hour),
+		SentRetention: env.GetDuration("OUTBOX_SENT_RETENTION", 7*24*time.Hour),
+	}
+}
+
+func getEncryptionConfig() config.EncryptionConfig {
+	return config.EncryptionConfig{
+		Keys:      env.GetString("EMAIL_ENCRYPTION_KEYS", ""),
+		KeyID:     env.GetString("EMAIL_ENCRYPTION_KEY_ID", ""),
+		IndexKey:  env.GetString("EMAIL_INDEX_KEY", ""),
+		BatchSize: env.GetInt("EMAIL_REENCRYPT_BATCH_SIZE", 500),
+	}
+}
+
+func getMailTemplatesDir() string {
+	return env.GetString("MAIL_TEMPLATES_DIR", "")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"weather/internal/config"
+	"weather/internal/env"
+	"weather/internal/fakeweather"
+
+	"github.com/gin-gonic/gin"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+func getFakeWeatherConfig() config.FakeWeatherConfig {
+	port := env.GetInt("FAKE_WEATHER_PORT", 8090)
+	fixedTime := env.GetString("FAKE_WEATHER_FIXED_TIME", "")
+
+	cfg := config.FakeWeatherConfig{
+		Addr:   fmt.Sprintf(":%d", port),
+		APIKey: env.GetString("FAKE_WEATHER_API_KEY", ""),
+		Seed:   int64(env.GetInt("FAKE_WEATHER_SEED", 1)),
+	}
+
+	if fixedTime != "" {
+		at, err := time.Parse(time.RFC3339, fixedTime)
+		if err != nil {
+			log.Fatalf("invalid FAKE_WEATHER_FIXED_TIME %q: %v", fixedTime, err)
+		}
+		cfg.FixedTime = at
+	}
+
+	return cfg
+}
+
+func main() {
+	cfg := getFakeWeatherConfig()
+
+	router := gin.Default()
+	fakeweather.NewServer(cfg).Mount(router)
+
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           router,
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+
+	go func() {
+		log.Printf("Starting fake weather API on %s (seed %d)", cfg.Addr, cfg.Seed)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Panicf("Server shutdown error: %v", err)
+	}
+}
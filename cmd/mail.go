@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"text/tabwriter"
+	"time"
+	"weather/internal/mailer"
+
+	"github.com/pkg/errors"
+)
+
+// MailTestTimeoutDuration bounds sending the test email, including
+// connecting to the mail server.
+const MailTestTimeoutDuration = 30 * time.Second
+
+// runMail handles "mail test|outbox".
+func runMail(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected test <address> or outbox stats")
+	}
+
+	switch args[0] {
+	case "test":
+		return sendTestMail(args[1:])
+	case "outbox":
+		if len(args) < 2 || args[1] != "stats" {
+			return errors.New("expected outbox stats")
+		}
+		return outboxStats(args[2:])
+	default:
+		return errors.Errorf("unknown mail command %q, expected test or outbox", args[0])
+	}
+}
+
+// sendTestMail sends an email through the configured transport right
+// away, bypassing the outbox, so delivery errors are reported as they
+// happen.
+func sendTestMail(args []string) error {
+	flags := newFlagSet("mail test", "<address>")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	to := flags.Arg(0)
+	if addr, err := mail.ParseAddress(to); err != nil || addr.Address != to {
+		return errors.Errorf("invalid address %q", to)
+	}
+
+	transportConfig := getMailTransportConfig()
+	transport, err := mailer.NewTransport(transportConfig, getSMTPConfig())
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := transport.Close(); closeErr != nil {
+			log.Printf("failed to close mail transport: %v\n", closeErr)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), MailTestTimeoutDuration)
+	defer cancel()
+
+	sentAt := time.Now()
+	err = transport.Send(ctx, mailer.Email{
+		To:      to,
+		Subject: "Weather service test email",
+		Body: fmt.Sprintf(
+			"This email was sent by the mail test command at %s through the %s transport.\n",
+			sentAt.Format(time.RFC1123Z), transportConfig.Kind,
+		),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to send test email through %s transport", transportConfig.Kind)
+	}
+
+	fmt.Printf("sent test email to %s through %s transport in %s\n", to, transportConfig.Kind, time.Since(sentAt))
+
+	return nil
+}
+
+// outboxStats prints how many outbox messages are in each state, which
+// production can't read over HTTP.
+func outboxStats(args []string) error {
+	flags := newFlagSet("mail outbox stats", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, storage, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	stats, err := storage.Outbox.Stats(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PENDING\tSENDING\tSENT\tDEAD")
+	fmt.Fprintf(w, "%d\t%d\t%d\t%d\n", stats.Pending, stats.Sending, stats.Sent, stats.Dead)
+
+	return w.Flush()
+}
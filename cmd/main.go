@@ -1,127 +1,83 @@
 package main
 
 import (
-	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
-	"time"
-	"weather/internal/application"
-	"weather/internal/config"
-	"weather/internal/database"
-	"weather/internal/env"
-	"weather/internal/mailer"
-	"weather/internal/store"
-	"weather/internal/weather"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
-func getDatabaseConfig() config.DBConfig {
-	dbName := env.GetString("DB_NAME", "weather")
-	dbPassword := env.GetString("DB_PASSWORD", "")
-	dbUser := env.GetString("DB_USER", "postgres")
-	dbHost := env.GetString("DB_HOST", "localhost")
-	dbPort := env.GetInt("DB_PORT", 5432)
-	dbSSL := env.GetString("DB_SSL_MODE", "")
+const binaryName = "weather-service"
 
-	dbAddr := fmt.Sprintf(
-		"user=%s password=%s host=%s port=%d dbname=%s sslmode=%s",
-		dbUser,
-		dbPassword,
-		dbHost,
-		dbPort,
-		dbName,
-		dbSSL,
-	)
-
-	return config.DBConfig{
-		Addr:         dbAddr,
-		MaxOpenConns: env.GetInt("MAX_OPEN_CONNS", 30),
-		MaxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 30),
-		MaxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
-	}
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string) error
 }
 
-func getApplicationConfig() config.ApplicationConfig {
-	appPort := env.GetInt("APP_PORT", 8080)
-	readTimeoutDuration := time.Duration(env.GetInt("READ_TIMEOUT", 5)) * time.Second
-	writeTimeoutDuration := time.Duration(env.GetInt("WRITE_TIMEOUT", 5)) * time.Second
-	idleTimeoutDuration := time.Duration(env.GetInt("IDLE_TIMEOUT", 5)) * time.Second
-	return config.ApplicationConfig{
-		Addr:         fmt.Sprintf(":%d", appPort),
-		ReadTimeout:  readTimeoutDuration,
-		WriteTimeout: writeTimeoutDuration,
-		IdleTimeout:  idleTimeoutDuration,
-	}
+var commands = []command{
+	{"serve", "", "migrates the database and runs the server (default)", runServe},
+	{"migrate", "up | down [steps] | status | version", "manages the database schema", runMigrate},
+	{"send-now", "--frequency=hourly|daily [--city=Kyiv]", "enqueues a mailing right away", runSendNow},
+	{"subscribers", "list | export | import", "lists, exports and imports subscriptions", runSubscribers},
+	{"weather", "get <city>", "asks the weather API for the current weather", runWeather},
+	{"mail", "test <address> | outbox stats", "sends a test email or counts outbox messages per state", runMail},
+	{"config", "check", "validates the configuration and the database connection", runConfig},
+	{"reencrypt", "[--batch-size=500]", "re-encrypts emails with the current key after a rotation", runReencrypt},
 }
 
-func getWeatherAPIConfig() config.WeatherAPIConfig {
-	weatherServiceURL := env.GetString("WEATHER_SERVICE_URL", "http://api.weatherapi.com/v1/current.json")
-	weatherAPIKey := env.GetString("WEATHER_API_KEY", "fake-api-key")
-
-	return config.WeatherAPIConfig{
-		ServiceBaseURL: weatherServiceURL,
-		APIKey:         weatherAPIKey,
+// newFlagSet parses the flags of a command; errors are returned to main.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s %s %s\n", binaryName, name, usage)
+		flags.PrintDefaults()
 	}
-}
 
-func getSMTPConfig() config.SMTPConfig {
-	smtpUser := env.GetString("SMTP_USER", "email")
-	smtpPassword := env.GetString("SMTP_PASS", "smash")
-	smtpHost := env.GetString("SMTP_HOST", "host")
-	smtpPort := env.GetString("SMTP_PORT", "port")
+	return flags
+}
 
-	return config.SMTPConfig{
-		SMTPUser:     smtpUser,
-		SMTPPassword: smtpPassword,
-		SMTPHost:     smtpHost,
-		SMTPPort:     smtpPort,
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [arguments]\n\ncommands:\n", binaryName)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %s %s\n        %s\n", c.name, c.usage, c.description)
 	}
 }
 
+// Every command shares the environment configuration of the server.
 func main() {
-	dbConfig := getDatabaseConfig()
-	appConfig := getApplicationConfig()
-
-	db, err := database.New(dbConfig)
-	if err != nil {
-		log.Fatal(err)
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"serve"}
 	}
 
-	err = database.ValidateConnection(db)
-	if err != nil {
-		log.Fatal(err)
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage()
+		return
 	}
 
-	store := store.NewStorage(db)
+	// Release mode also changes what the mail transport allows.
+	gin.SetMode(getApplicationConfig().Mode)
 
-	defer func() {
-		err := db.Close()
-		if err != nil {
-			log.Fatal(err)
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
 		}
-	}()
 
-	weatherServiceConfig := getWeatherAPIConfig()
-	weatherService := weather.NewRemoteService(weather.NewWeatherAPI(weatherServiceConfig))
-
-	smtpConfig := getSMTPConfig()
-	mailerService := mailer.New(smtpConfig, weatherService)
-
-	ctx, cancel := context.WithTimeout(context.Background(), mailer.LoadTimeoutDuration)
-	err = mailerService.LoadTargets(ctx, store.Mailer)
-	cancel()
-	if err != nil {
-		log.Panic(err)
-	}
-
-	app := application.Application{
-		Config:         appConfig,
-		Store:          store,
-		Router:         gin.Default(),
-		WeatherService: weatherService,
-		MailerService:  mailerService,
+		err := c.run(args[1:])
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		if err != nil {
+			log.Fatalf("%s: %v", c.name, err)
+		}
+		return
 	}
 
-	app.Run()
+	usage()
+	os.Exit(2)
 }
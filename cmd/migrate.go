@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+	"weather/internal/database"
+
+	"github.com/pkg/errors"
+)
+
+// MigrateTimeoutDuration bounds applying migrations, including waiting for
+// another replica holding the migrations lock.
+const MigrateTimeoutDuration = 5 * time.Minute
+
+// runMigrate handles "migrate up|down [steps]|status|version".
+func runMigrate(args []string) error {
+	flags := newFlagSet("migrate", "up | down [steps] | status | version")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), MigrateTimeoutDuration)
+	defer cancel()
+
+	switch flags.Arg(0) {
+	case "", "up":
+		return migrateUp(migrator)
+	case "down":
+		steps := 1
+		if flags.NArg() > 1 {
+			n, err := strconv.Atoi(flags.Arg(1))
+			if err != nil || n < 1 {
+				return errors.Errorf("invalid number of steps %q", flags.Arg(1))
+			}
+			steps = n
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			log.Printf("reverted migration %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("version %d of %d, dirty: %t\n", status.Version, status.Latest, status.Dirty)
+		if status.Version > status.Latest {
+			fmt.Println("the database schema is newer than this binary")
+		}
+		for _, m := range status.Pending {
+			fmt.Printf("pending %d_%s\n", m.Version, m.Name)
+		}
+		return nil
+	case "version":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		if status.Dirty {
+			fmt.Printf("%d (dirty)\n", status.Version)
+		} else {
+			fmt.Println(status.Version)
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown migrate command %q, expected up, down, status or version", flags.Arg(0))
+	}
+}
+
+func migrateUp(migrator *database.Migrator) error {
+	ctx, cancel := context.WithTimeout(context.Background(), MigrateTimeoutDuration)
+	defer cancel()
+
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		log.Printf("applied migration %d_%s\n", m.Version, m.Name)
+	}
+	if err == nil && len(applied) == 0 {
+		log.Printf("no migration to apply\n")
+	}
+
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+	"weather/internal/store"
+
+	"github.com/pkg/errors"
+)
+
+// reencryptRetryDelay is how long to wait for rows locked by another
+// process, e.g. a replica running the same backfill.
+const reencryptRetryDelay = time.Second
+
+// runReencrypt moves every row onto the current key after a rotation,
+// while the service keeps running with both keys configured.
+func runReencrypt(args []string) error {
+	flags := newFlagSet("reencrypt", "")
+	batchSize := flags.Int("batch-size", getEncryptionConfig().BatchSize, "rows re-encrypted per transaction")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, storage, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	changed, err := reencryptEmails(storage, *batchSize, true)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("re-encrypted %d rows with key %q\n", changed, getEncryptionConfig().KeyID)
+
+	return nil
+}
+
+// reencryptEmails repeats re-encryption batches until no row is left.
+// Batches skip locked rows, so an empty batch only ends it once no row
+// is counted either.
+func reencryptEmails(s store.Storage, batchSize int, rotate bool) (int, error) {
+	if batchSize <= 0 {
+		return 0, errors.Errorf("batch size must be positive, got %d", batchSize)
+	}
+
+	total := 0
+	for {
+		changed, err := s.Encryption.Reencrypt(context.Background(), batchSize, rotate)
+		total += changed
+		if err != nil {
+			return total, err
+		}
+		if changed > 0 {
+			continue
+		}
+
+		remaining, err := s.Encryption.Remaining(context.Background(), rotate)
+		if err != nil || remaining == 0 {
+			return total, err
+		}
+
+		log.Printf("%d rows to encrypt are locked by another process, retrying\n", remaining)
+		time.Sleep(reencryptRetryDelay)
+	}
+}
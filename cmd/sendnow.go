@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"weather/internal/mailer"
+	"weather/internal/models"
+
+	"github.com/pkg/errors"
+)
+
+// runSendNow enqueues a mailing outside of its schedule, e.g. to make up
+// for one missed during an outage. The running service delivers it
+// through the outbox.
+func runSendNow(args []string) error {
+	flags := newFlagSet("send-now", "--frequency=hourly|daily [--city=Kyiv]")
+	frequency := flags.String("frequency", "", "frequency of the subscriptions to mail (required)")
+	city := flags.String("city", "", "only mail subscriptions to this city")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *frequency != models.Hourly && *frequency != models.Daily {
+		return errors.Errorf("--frequency must be %s or %s", models.Hourly, models.Daily)
+	}
+
+	appConfig := getApplicationConfig()
+
+	db, storage, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	signer, err := newSigner()
+	if err != nil {
+		return err
+	}
+
+	mailerService, err := newMailer(appConfig, storage, newWeatherService(), signer)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := mailerService.Mailer.Close(); err != nil {
+			log.Printf("failed to close mail transport: %v\n", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), mailer.LoadTimeoutDuration)
+	err = mailerService.LoadTargets(ctx, storage.Mailer)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	timeout := mailer.SendEmailHourlyTimeout
+	if *frequency == models.Daily {
+		timeout = mailer.SendEmailDailyTimeout
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	targets, enqueued, err := mailerService.SendNow(ctx, *frequency, *city)
+	if err != nil {
+		return errors.Wrapf(err, "failed to enqueue %d emails", enqueued)
+	}
+
+	fmt.Printf("%d of %d %s subscriptions enqueued, the rest had no forecast\n", enqueued, targets, *frequency)
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+	"weather/internal/application"
+	"weather/internal/database"
+	"weather/internal/janitor"
+	"weather/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+)
+
+func runServe(args []string) error {
+	flags := newFlagSet("serve", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	appConfig := getApplicationConfig()
+
+	db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	// Replicas wait for each other on the migrations lock, and a schema
+	// newer than this binary stops it from starting.
+	if err := migrateUp(migrator); err != nil {
+		return err
+	}
+
+	store, _, err := newStorage(db)
+	if err != nil {
+		return err
+	}
+
+	// Encrypts rows stored before encryption, so lookups by blind index find them.
+	encrypted, err := reencryptEmails(store, getEncryptionConfig().BatchSize, false)
+	if err != nil {
+		return err
+	}
+	if encrypted > 0 {
+		log.Printf("encrypted emails of %d rows\n", encrypted)
+	}
+
+	subscriptionConfig := getSubscriptionConfig()
+	signer, err := newSigner()
+	if err != nil {
+		return err
+	}
+
+	weatherService := newWeatherService()
+	mailerService, err := newMailer(appConfig, store, weatherService, signer)
+	if err != nil {
+		return err
+	}
+
+	// Runs once per legacy row after an upgrade, so it gets more time than loading.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	assigned, err := store.Subscription.AssignUnsubscribeSalts(ctx, signer.Unsubscribe)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if assigned > 0 {
+		log.Printf("assigned unsubscribe tokens to %d subscriptions\n", assigned)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), mailer.LoadTimeoutDuration)
+	err = mailerService.LoadTargets(ctx, store.Mailer)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	manageConfig := getManageConfig(appConfig.PublicBaseURL)
+
+	app := application.Application{
+		Config:         appConfig,
+		Store:          store,
+		Router:         gin.Default(),
+		WeatherService: weatherService,
+		MailerService:  mailerService,
+		Signer:         signer,
+		Janitor: janitor.New(
+			store.Subscription,
+			store.Outbox,
+			store.Session,
+			mailerService.Builder,
+			mailerService.Outbox,
+			subscriptionConfig,
+			getOutboxConfig().SentRetention,
+			max(manageConfig.SessionTTL, manageConfig.LinkInterval, subscriptionConfig.ResendInterval),
+		),
+		SubscriptionConfig: subscriptionConfig,
+		ManageConfig:       manageConfig,
+	}
+
+	app.Run()
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"weather/internal/i18n"
+	"weather/internal/models"
+	"weather/internal/store"
+	"weather/internal/token"
+
+	joinErr "errors"
+
+	"github.com/pkg/errors"
+)
+
+// errNotImportable marks subscriptions import skips instead of failing,
+// as exports include every status.
+var errNotImportable = errors.New("status can't be imported")
+
+// runSubscribers handles "subscribers list|export|import".
+func runSubscribers(args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected list, export or import")
+	}
+
+	switch args[0] {
+	case "list":
+		return listSubscribers(args[1:])
+	case "export":
+		return exportSubscribers(args[1:])
+	case "import":
+		return importSubscribers(args[1:])
+	default:
+		return errors.Errorf("unknown subscribers command %q, expected list, export or import", args[0])
+	}
+}
+
+func filterFlags(flags *flag.FlagSet) *models.SubscriptionFilter {
+	var filter models.SubscriptionFilter
+	flags.StringVar(&filter.Status, "status", "", "only subscriptions with this status")
+	flags.StringVar(&filter.City, "city", "", "only subscriptions to this city")
+	flags.StringVar(&filter.Frequency, "frequency", "", "only subscriptions with this frequency")
+
+	return &filter
+}
+
+func listSubscriptions(filter models.SubscriptionFilter) ([]models.Subscription, error) {
+	db, storage, err := openStorage()
+	if err != nil {
+		return nil, err
+	}
+	defer closeDatabase(db)
+
+	return storage.Subscription.List(context.Background(), filter)
+}
+
+func listSubscribers(args []string) error {
+	flags := newFlagSet("subscribers list", "[--status=active] [--city=Kyiv] [--frequency=daily]")
+	filter := filterFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	subs, err := listSubscriptions(*filter)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tCITY\tFREQUENCY\tSTATUS\tLANGUAGE\tUNITS\tHOUR\tCREATED")
+	for _, sub := range subs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			sub.ID, sub.Email, sub.City, sub.Frequency, sub.Status,
+			sub.Language, sub.Units, sub.DeliveryHour, sub.CreatedAt.Format(time.DateTime))
+	}
+	fmt.Fprintf(w, "%d subscriptions\n", len(subs))
+
+	return w.Flush()
+}
+
+// exportSubscribers writes the subscriptions as JSON, in the format
+// import reads. Emails are decrypted, so the file must be kept safe.
+func exportSubscribers(args []string) (err error) {
+	flags := newFlagSet("subscribers export", "[--output=subscribers.json] [--status=active] [--city=Kyiv] [--frequency=daily]")
+	filter := filterFlags(flags)
+	output := flags.String("output", "", "file to write, standard output by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	subs, err := listSubscriptions(*filter)
+	if err != nil {
+		return err
+	}
+	if subs == nil {
+		subs = []models.Subscription{}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return errors.Wrap(err, "failed to create export file")
+		}
+
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil {
+				err = joinErr.Join(err, errors.Wrap(closeErr, "failed to close export file"))
+			}
+		}()
+		w = file
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(subs); err != nil {
+		return errors.Wrap(err, "failed to write subscriptions")
+	}
+
+	if *output != "" {
+		fmt.Printf("exported %d subscriptions to %s\n", len(subs), *output)
+	}
+
+	return nil
+}
+
+// importSubscribers stores subscriptions exported by export or another
+// system. They were confirmed there, so no confirmation is sent; the
+// running service mails them after its next restart. Pending and bounced
+// subscriptions are skipped and reported; any other invalid subscription
+// fails the whole import.
+func importSubscribers(args []string) error {
+	flags := newFlagSet("subscribers import", "[--input=subscribers.json]")
+	input := flags.String("input", "", "file to read, standard input by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if *input != "" {
+		data, err = os.ReadFile(*input)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read import file")
+	}
+
+	var subs []models.Subscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return errors.Wrap(err, "failed to parse subscriptions")
+	}
+
+	signer, err := newSigner()
+	if err != nil {
+		return err
+	}
+
+	importable := make([]models.Subscription, 0, len(subs))
+	for i, sub := range subs {
+		err := prepareImport(&sub, signer)
+		if errors.Is(err, errNotImportable) {
+			fmt.Fprintf(os.Stderr, "skipping subscription %d of %d: %v\n", i+1, len(subs), err)
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "subscription %d of %d", i+1, len(subs))
+		}
+		importable = append(importable, sub)
+	}
+
+	db, storage, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), store.ListTimeoutDuration)
+	defer cancel()
+
+	imported, err := storage.Subscription.Import(ctx, importable)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"imported %d subscriptions, skipped %d existing ones and %d with a status that can't be imported\n",
+		len(imported), len(importable)-len(imported), len(subs)-len(importable),
+	)
+	if len(imported) > 0 {
+		fmt.Println("restart the service to start mailing them")
+	}
+
+	return nil
+}
+
+// prepareImport validates the subscription, fills in defaults and issues
+// its unsubscribe token.
+func prepareImport(sub *models.Subscription, signer *token.Signer) error {
+	if addr, err := mail.ParseAddress(sub.Email); err != nil || addr.Address != sub.Email {
+		return errors.Errorf("invalid email %q", sub.Email)
+	}
+	if strings.TrimSpace(sub.City) == "" {
+		return errors.New("city is required")
+	}
+	if sub.Frequency != models.Hourly && sub.Frequency != models.Daily {
+		return errors.Errorf("invalid frequency %q", sub.Frequency)
+	}
+
+	if sub.Language == "" {
+		sub.Language = i18n.Default
+	}
+	if !i18n.Supported(sub.Language) {
+		return errors.Errorf("unsupported language %q", sub.Language)
+	}
+
+	if sub.Units == "" {
+		sub.Units = models.UnitsMetric
+	}
+	if sub.Units != models.UnitsMetric && sub.Units != models.UnitsImperial {
+		return errors.Errorf("invalid units %q", sub.Units)
+	}
+
+	if sub.DeliveryHour < 0 || sub.DeliveryHour > 23 {
+		return errors.Errorf("invalid delivery hour %d", sub.DeliveryHour)
+	}
+
+	if sub.Status == "" {
+		sub.Status = models.StatusActive
+	}
+	switch sub.Status {
+	case models.StatusActive, models.StatusPaused, models.StatusUnsubscribed:
+	case models.StatusPending, models.StatusBounced:
+		// Pending subscriptions would need a confirmation email and bounced ones a working address.
+		return errors.Wrapf(errNotImportable, "%s subscription", sub.Status)
+	default:
+		return errors.Errorf("invalid status %q", sub.Status)
+	}
+
+	salt, err := token.Generate()
+	if err != nil {
+		return err
+	}
+	sub.UnsubscribeSalt = salt
+	sub.UnsubscribeToken = signer.Unsubscribe(salt)
+
+	return nil
+}
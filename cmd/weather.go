@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+	"weather/internal/weather"
+
+	"github.com/pkg/errors"
+)
+
+// WeatherTimeoutDuration bounds a single weather API request.
+const WeatherTimeoutDuration = 10 * time.Second
+
+// runWeather handles "weather get <city>", asking the weather API directly
+// with the service's configuration.
+func runWeather(args []string) error {
+	flags := newFlagSet("weather get", "<city>")
+	if len(args) == 0 || args[0] != "get" {
+		return errors.New("expected get <city>")
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	city := strings.Join(flags.Args(), " ")
+	if strings.TrimSpace(city) == "" {
+		return errors.New("city is required")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), WeatherTimeoutDuration)
+	defer cancel()
+
+	current, err := weather.NewWeatherAPI(getWeatherAPIConfig()).GetCityWeather(ctx, city)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return errors.Wrap(encoder.Encode(current), "failed to print weather")
+}
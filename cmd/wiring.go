@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"log"
+	"weather/internal/config"
+	"weather/internal/database"
+	"weather/internal/encryption"
+	"weather/internal/mailer"
+	"weather/internal/store"
+	"weather/internal/token"
+	"weather/internal/weather"
+
+	joinErr "errors"
+
+	"github.com/pkg/errors"
+)
+
+// errSchemaOutdated stops commands other than serve and migrate, which
+// don't migrate the database themselves.
+var errSchemaOutdated = errors.New("database schema is outdated, run `migrate up` first")
+
+// errNoPublicBaseURL stops release mode from mailing links without a host.
+var errNoPublicBaseURL = errors.New("PUBLIC_BASE_URL must be set in release mode")
+
+func openDatabase() (*sql.DB, error) {
+	db, err := database.New(getDatabaseConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.ValidateConnection(db); err != nil {
+		return nil, joinErr.Join(err, db.Close())
+	}
+
+	return db, nil
+}
+
+func closeDatabase(db *sql.DB) {
+	if err := db.Close(); err != nil {
+		log.Printf("failed to close database: %v\n", err)
+	}
+}
+
+// checkSchema makes sure the schema matches the migrations of this binary.
+func checkSchema(db *sql.DB) error {
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), MigrateTimeoutDuration)
+	defer cancel()
+
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if err := status.Check(); err != nil {
+		return err
+	}
+	if len(status.Pending) > 0 {
+		return errors.Wrapf(errSchemaOutdated, "database is at version %d of %d", status.Version, status.Latest)
+	}
+
+	return nil
+}
+
+func newKeyring(cfg config.EncryptionConfig) (*encryption.Keyring, error) {
+	keys, err := encryption.ParseKeys(cfg.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	indexKey, err := base64.StdEncoding.DecodeString(cfg.IndexKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "EMAIL_INDEX_KEY is not valid base64")
+	}
+
+	return encryption.NewKeyring(keys, cfg.KeyID, indexKey)
+}
+
+func newStorage(db *sql.DB) (store.Storage, *encryption.Keyring, error) {
+	keyring, err := newKeyring(getEncryptionConfig())
+	if err != nil {
+		return store.Storage{}, nil, err
+	}
+
+	return store.NewStorage(db, keyring), keyring, nil
+}
+
+// openStorage opens the database, which must be fully migrated, for
+// commands run next to the server.
+func openStorage() (*sql.DB, store.Storage, error) {
+	db, err := openDatabase()
+	if err != nil {
+		return nil, store.Storage{}, err
+	}
+
+	if err := checkSchema(db); err != nil {
+		return nil, store.Storage{}, joinErr.Join(err, db.Close())
+	}
+
+	storage, _, err := newStorage(db)
+	if err != nil {
+		return nil, store.Storage{}, joinErr.Join(err, db.Close())
+	}
+
+	return db, storage, nil
+}
+
+func newWeatherService() *weather.RemoteService {
+	weatherServiceConfig := getWeatherAPIConfig()
+
+	return weather.NewRemoteService(
+		weather.NewWeatherAPI(weatherServiceConfig),
+		weather.NewCache(weatherServiceConfig.CacheTTL),
+	)
+}
+
+func newSigner() (*token.Signer, error) {
+	return token.NewSigner(getSubscriptionConfig().TokenSecret)
+}
+
+func newEmailBuilder(publicBaseURL string) (*mailer.EmailBuilder, error) {
+	if publicBaseURL == "" {
+		return nil, errNoPublicBaseURL
+	}
+
+	renderer, err := mailer.NewRenderer(getMailTemplatesDir())
+	if err != nil {
+		return nil, err
+	}
+
+	return mailer.NewEmailBuilder(renderer, publicBaseURL), nil
+}
+
+// newMailer wires the mailer the way the server runs it.
+func newMailer(
+	appConfig config.ApplicationConfig,
+	storage store.Storage,
+	weatherService *weather.RemoteService,
+	signer *token.Signer,
+) (*mailer.Manager, error) {
+	transport, err := mailer.NewTransport(getMailTransportConfig(), getSMTPConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := newEmailBuilder(appConfig.PublicBaseURL)
+	if err != nil {
+		return nil, joinErr.Join(err, transport.Close())
+	}
+
+	return mailer.New(
+		transport,
+		builder,
+		getMailerConfig(),
+		getOutboxConfig(),
+		storage.Outbox,
+		weatherService,
+		signer,
+	), nil
+}
@@ -3,22 +3,63 @@ package api
 import (
 	"weather/internal/api/handlers"
 	"weather/internal/api/middleware"
+	"weather/internal/config"
 	"weather/internal/weather"
 
 	"github.com/gin-gonic/gin"
 )
 
+type Store interface {
+	handlers.SubscriptionStore
+	handlers.ManageStore
+}
+
+type EmailBuilder interface {
+	handlers.EmailBuilder
+	handlers.ManageEmailBuilder
+}
+
+type Signer interface {
+	handlers.TokenSigner
+	handlers.SessionSigner
+}
+
 func Mount(
 	router *gin.Engine,
-	storage handlers.SubscriptionStore,
+	storage Store,
 	weatherService *weather.RemoteService,
-	emailSender handlers.EmailSender,
+	emailQueue handlers.EmailQueue,
+	emailBuilder EmailBuilder,
+	signer Signer,
 	targetManager handlers.SubscriptionTargetManager,
+	privacyStore handlers.PrivacyStore,
+	sessionStore handlers.SessionStore,
+	outboxStore handlers.OutboxStatsStore,
+	mailbox handlers.Mailbox,
+	subscriptionConfig config.SubscriptionConfig,
+	manageConfig config.ManageConfig,
 ) {
-	gin.SetMode(gin.ReleaseMode)
-
 	weatherHandler := handlers.NewWeatherHandler(weatherService)
-	subscriptionHandler := handlers.NewSubscriptionHandler(storage, emailSender, targetManager)
+	subscriptionHandler := handlers.NewSubscriptionHandler(
+		storage,
+		emailQueue,
+		emailBuilder,
+		signer,
+		targetManager,
+		sessionStore,
+		subscriptionConfig.ConfirmationTTL,
+		subscriptionConfig.ResendInterval,
+	)
+	manageHandler := handlers.NewManageHandler(
+		storage,
+		privacyStore,
+		sessionStore,
+		emailQueue,
+		emailBuilder,
+		signer,
+		targetManager,
+		manageConfig,
+	)
 
 	api := router.Group("/api")
 
@@ -32,7 +73,55 @@ func Mount(
 	subscriptionGroup.Use(middleware.ExtractParam("token"))
 	{
 		subscriptionGroup.POST("/subscribe", subscriptionHandler.Subscribe)
+		subscriptionGroup.POST("/subscribe/resend", subscriptionHandler.ResendConfirmation)
 		subscriptionGroup.GET("/confirm/:token", subscriptionHandler.Confirm)
+		subscriptionGroup.GET("/cancel/:token", subscriptionHandler.ConfirmCancel)
+		subscriptionGroup.POST("/cancel/:token", subscriptionHandler.Cancel)
 		subscriptionGroup.GET("/unsubscribe/:token", subscriptionHandler.Unsubscribe)
+		// One-click unsubscribe (RFC 8058) posted by mail clients.
+		subscriptionGroup.POST("/unsubscribe/:token", subscriptionHandler.Unsubscribe)
+		// Self-service management authenticated by the unsubscribe token.
+		subscriptionGroup.GET("/subscriptions/:token", subscriptionHandler.Get)
+		subscriptionGroup.PATCH("/subscriptions/:token", subscriptionHandler.Update)
+		subscriptionGroup.POST("/subscriptions/:token/pause", subscriptionHandler.Pause)
+		subscriptionGroup.POST("/subscriptions/:token/resume", subscriptionHandler.Resume)
+	}
+
+	manageGroup := api.Group("/manage")
+	manageGroup.Use(
+		middleware.ExtractParam("token"),
+		middleware.ExtractBearer("session", handlers.SessionCookie),
+	)
+	{
+		manageGroup.POST("", manageHandler.RequestLink)
+		manageGroup.GET("/login/:token", manageHandler.Login)
+		manageGroup.POST("/logout", manageHandler.Logout)
+		manageGroup.GET("/subscriptions", manageHandler.List)
+		manageGroup.POST("/unsubscribe", manageHandler.Unsubscribe)
+		manageGroup.GET("/export", manageHandler.Export)
+		manageGroup.POST("/erase", manageHandler.Erase)
+	}
+
+	// Operational endpoints aren't authenticated, so they stay out of
+	// release mode.
+	if gin.Mode() != gin.ReleaseMode {
+		outboxHandler := handlers.NewOutboxHandler(outboxStore)
+
+		outboxGroup := api.Group("/outbox")
+		{
+			outboxGroup.GET("/stats", outboxHandler.Stats)
+		}
+	}
+
+	// The dev mailbox exposes every outgoing email, tokens included.
+	if mailbox != nil && gin.Mode() != gin.ReleaseMode {
+		mailboxHandler := handlers.NewMailboxHandler(mailbox)
+
+		devGroup := router.Group("/dev")
+		{
+			devGroup.GET("/mailbox", mailboxHandler.List)
+			devGroup.GET("/mailbox/:id", mailboxHandler.Show)
+			devGroup.DELETE("/mailbox", mailboxHandler.Clear)
+		}
 	}
 }
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"weather/internal/mailer"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Mailbox interface {
+	List() []mailer.StoredEmail
+	Get(id int64) (mailer.StoredEmail, bool)
+	Clear()
+}
+
+var mailboxEmailPage = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body>
+<dl>
+<dt>From</dt><dd>{{.From}}</dd>
+<dt>To</dt><dd>{{.To}}</dd>
+<dt>Subject</dt><dd>{{.Subject}}</dd>
+<dt>Sent at</dt><dd>{{.SentAt.Format "2006-01-02 15:04:05"}}</dd>
+</dl>
+<hr>
+{{if .HTML}}<iframe title="HTML part" srcdoc="{{.HTML}}" style="width:100%;height:70vh;border:0;"></iframe>
+<hr>
+{{end}}<pre>{{.Body}}</pre>
+</body>
+</html>
+`))
+
+type MailboxHandler struct {
+	mailbox Mailbox
+}
+
+func NewMailboxHandler(mailbox Mailbox) *MailboxHandler {
+	return &MailboxHandler{
+		mailbox: mailbox,
+	}
+}
+
+func (h *MailboxHandler) List(c *gin.Context) {
+	c.JSON(http.StatusOK, h.mailbox.List())
+}
+
+// Show renders the email as an HTML page, or as plain text with ?format=plain.
+func (h *MailboxHandler) Show(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, "Invalid email id")
+		return
+	}
+
+	email, ok := h.mailbox.Get(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, "Email not found")
+		return
+	}
+
+	if c.Query("format") == "plain" {
+		c.String(http.StatusOK, email.Body)
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := mailboxEmailPage.Execute(c.Writer, email); err != nil {
+		logErrorF(err, "can't render email")
+	}
+}
+
+func (h *MailboxHandler) Clear(c *gin.Context) {
+	h.mailbox.Clear()
+	c.Status(http.StatusNoContent)
+}
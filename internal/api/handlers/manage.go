@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"weather/internal/config"
+	"weather/internal/mailer"
+	"weather/internal/models"
+	"weather/internal/srverrors"
+	"weather/internal/token"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SessionCookie carries the management session in browsers.
+	SessionCookie = "manage_session"
+
+	manageLinkPurpose    = "manage-link"
+	manageSessionPurpose = "manage-session"
+)
+
+var (
+	errSessionNotFound = errors.New("session not found")
+	errSessionRevoked  = errors.New("session was revoked")
+)
+
+type ManageStore interface {
+	ListByEmail(ctx context.Context, email string) ([]models.Subscription, error)
+	UnsubscribeByEmail(ctx context.Context, email string, ids []int64) ([]models.Subscription, error)
+}
+
+// SessionStore revokes sessions, which are otherwise stateless, and
+// throttles login links.
+type SessionStore interface {
+	Start(ctx context.Context, email string) (int, error)
+	Generation(ctx context.Context, email string) (int, error)
+	Revoke(ctx context.Context, email string) error
+	AllowLinkRequest(ctx context.Context, email string, interval time.Duration) (bool, error)
+	ConfirmationThrottle
+}
+
+type PrivacyStore interface {
+	Export(ctx context.Context, email string) (models.SubscriberData, error)
+	Erase(ctx context.Context, email string) (models.Erasure, error)
+}
+
+type ManageEmailBuilder interface {
+	BuildManageEmail(to, language, loginToken string, validFor time.Duration) (mailer.Email, error)
+	BuildUnsubscribeEmail(sub models.Subscription) (mailer.Email, error)
+}
+
+// SessionSigner issues the short-lived tokens of magic links and sessions.
+type SessionSigner interface {
+	Issue(purpose, subject string, expiresAt time.Time) string
+	Verify(purpose, value string) (string, error)
+}
+
+// ManageHandler gives the owner of an email access to all of its
+// subscriptions after proving access to the mailbox.
+type ManageHandler struct {
+	store         ManageStore
+	privacy       PrivacyStore
+	sessions      SessionStore
+	emailQueue    EmailQueue
+	emailBuilder  ManageEmailBuilder
+	signer        SessionSigner
+	targetManager SubscriptionTargetManager
+	config        config.ManageConfig
+}
+
+type manageRequest struct {
+	Email string `json:"email"`
+}
+
+type bulkUnsubscribeRequest struct {
+	IDs []int64 `json:"ids"`
+}
+
+type sessionResponse struct {
+	Session   string    `json:"session"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewManageHandler(
+	store ManageStore,
+	privacy PrivacyStore,
+	sessions SessionStore,
+	emailQueue EmailQueue,
+	emailBuilder ManageEmailBuilder,
+	signer SessionSigner,
+	targetManager SubscriptionTargetManager,
+	manageConfig config.ManageConfig,
+) *ManageHandler {
+	return &ManageHandler{
+		store:         store,
+		privacy:       privacy,
+		sessions:      sessions,
+		emailQueue:    emailQueue,
+		emailBuilder:  emailBuilder,
+		signer:        signer,
+		targetManager: targetManager,
+		config:        manageConfig,
+	}
+}
+
+// RequestLink emails a login link to addresses with subscriptions. The
+// response is the same either way, so it doesn't reveal who is subscribed;
+// for the same reason every address is throttled, subscribed or not.
+func (h *ManageHandler) RequestLink(c *gin.Context) {
+	var req manageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logErrorF(err, "cant bind request to json")
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil || addr.Address != req.Email {
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	allowed, err := h.sessions.AllowLinkRequest(c.Request.Context(), req.Email, h.config.LinkInterval)
+	if err != nil {
+		logErrorF(err, "can't throttle login link")
+		c.JSON(http.StatusInternalServerError, "Can't send login link")
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusTooManyRequests, "A login link was requested recently, please check your inbox or try again later")
+		return
+	}
+
+	subs, err := h.store.ListByEmail(c.Request.Context(), req.Email)
+	if err != nil {
+		logErrorF(err, "can't list subscriptions")
+		c.JSON(http.StatusInternalServerError, "Can't send login link")
+		return
+	}
+
+	if len(subs) > 0 {
+		// The most recent subscription has the latest language choice.
+		language := subs[len(subs)-1].Language
+		loginToken := h.signer.Issue(manageLinkPurpose, req.Email, time.Now().Add(h.config.LinkTTL))
+
+		email, err := h.emailBuilder.BuildManageEmail(req.Email, language, loginToken, h.config.LinkTTL)
+		if err == nil {
+			err = h.emailQueue.Enqueue(c.Request.Context(), email)
+		}
+		if err != nil {
+			logErrorF(err, "failed to queue login link")
+			c.JSON(http.StatusInternalServerError, "Can't send login link")
+			return
+		}
+	}
+
+	c.JSON(http.StatusAccepted, "If the address has subscriptions, a login link was sent to it.")
+}
+
+// Login exchanges the emailed link for a session, returned both as a cookie
+// and in the body for use as a bearer token.
+func (h *ManageHandler) Login(c *gin.Context) {
+	loginToken, err := validateToken(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	email, err := h.signer.Verify(manageLinkPurpose, loginToken)
+	if err != nil {
+		logErrorF(err, "can't verify login link")
+		if errors.Is(err, token.ErrExpired) {
+			c.JSON(http.StatusGone, "Login link expired, please request a new one")
+		} else {
+			c.JSON(http.StatusUnauthorized, "Invalid login link")
+		}
+		return
+	}
+
+	generation, err := h.sessions.Start(c.Request.Context(), email)
+	if err != nil {
+		logErrorF(err, "can't start session")
+		c.JSON(http.StatusInternalServerError, "Can't log in")
+		return
+	}
+
+	expiresAt := time.Now().Add(h.config.SessionTTL)
+	session := h.signer.Issue(manageSessionPurpose, strconv.Itoa(generation)+":"+email, expiresAt)
+
+	h.setSessionCookie(c, session, int(h.config.SessionTTL.Seconds()))
+
+	c.JSON(http.StatusOK, sessionResponse{Session: session, ExpiresAt: expiresAt})
+}
+
+// Logout ends every session of the email, including bearer tokens held
+// elsewhere.
+func (h *ManageHandler) Logout(c *gin.Context) {
+	if email, err := h.sessionEmail(c); err == nil {
+		if err := h.sessions.Revoke(c.Request.Context(), email); err != nil {
+			logErrorF(err, "can't revoke sessions")
+			c.JSON(http.StatusInternalServerError, "Can't log out")
+			return
+		}
+	}
+
+	h.setSessionCookie(c, "", -1)
+
+	c.JSON(http.StatusOK, "Logged out")
+}
+
+func (h *ManageHandler) List(c *gin.Context) {
+	email, err := h.sessionEmail(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, "Invalid or expired session")
+		return
+	}
+
+	subs, err := h.store.ListByEmail(c.Request.Context(), email)
+	if err != nil {
+		logErrorF(err, "can't list subscriptions")
+		c.JSON(http.StatusInternalServerError, "Can't list subscriptions")
+		return
+	}
+
+	if subs == nil {
+		subs = []models.Subscription{}
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+// Unsubscribe unsubscribes the subscriptions with the requested IDs,
+// or all subscriptions of the session's email when no IDs are given.
+func (h *ManageHandler) Unsubscribe(c *gin.Context) {
+	email, err := h.sessionEmail(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, "Invalid or expired session")
+		return
+	}
+
+	var req bulkUnsubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		logErrorF(err, "cant bind request to json")
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	subs, err := h.store.UnsubscribeByEmail(c.Request.Context(), email, req.IDs)
+	if err != nil {
+		logErrorF(err, "can't unsubscribe subscriptions")
+		c.JSON(http.StatusInternalServerError, "Can't unsubscribe")
+		return
+	}
+
+	farewells := make([]mailer.Email, 0, len(subs))
+	for _, sub := range subs {
+		h.targetManager.RemoveTarget(sub.ID)
+
+		farewell, err := h.emailBuilder.BuildUnsubscribeEmail(sub)
+		if err != nil {
+			logErrorF(err, "can't build unsubscribe email")
+			continue
+		}
+		farewells = append(farewells, farewell)
+	}
+
+	if err := h.emailQueue.Enqueue(c.Request.Context(), farewells...); err != nil {
+		logErrorF(err, "failed to queue unsubscribe emails")
+	}
+
+	if subs == nil {
+		subs = []models.Subscription{}
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+// Export downloads everything stored about the session's email.
+func (h *ManageHandler) Export(c *gin.Context) {
+	email, err := h.sessionEmail(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, "Invalid or expired session")
+		return
+	}
+
+	data, err := h.privacy.Export(c.Request.Context(), email)
+	if err != nil {
+		logErrorF(err, "can't export subscriber data")
+		c.JSON(http.StatusInternalServerError, "Can't export data")
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="weather-subscriber-data.json"`)
+	c.JSON(http.StatusOK, data)
+}
+
+// Erase permanently deletes everything stored about the session's email,
+// including emails still waiting in the outbox, and ends the session.
+func (h *ManageHandler) Erase(c *gin.Context) {
+	email, err := h.sessionEmail(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, "Invalid or expired session")
+		return
+	}
+
+	erasure, err := h.privacy.Erase(c.Request.Context(), email)
+	if err != nil {
+		logErrorF(err, "can't erase subscriber data")
+		c.JSON(http.StatusInternalServerError, "Can't erase data")
+		return
+	}
+
+	for _, id := range erasure.SubscriptionIDs {
+		h.targetManager.RemoveTarget(id)
+	}
+
+	log.Printf("erased %d subscriptions, %d outbox messages and %d audit events on request\n",
+		len(erasure.SubscriptionIDs), erasure.OutboxMessages, erasure.AuditEvents)
+
+	h.setSessionCookie(c, "", -1)
+
+	c.JSON(http.StatusOK, erasure)
+}
+
+// sessionEmail returns the email of a valid session. Sessions carry the
+// generation they were issued with, which Revoke moves past; erasure drops
+// the generation altogether.
+func (h *ManageHandler) sessionEmail(c *gin.Context) (string, error) {
+	session := c.GetString("session")
+	if session == "" {
+		return "", errSessionNotFound
+	}
+
+	subject, err := h.signer.Verify(manageSessionPurpose, session)
+	if err != nil {
+		return "", err
+	}
+
+	issued, email, ok := strings.Cut(subject, ":")
+	generation, err := strconv.Atoi(issued)
+	if !ok || err != nil {
+		return "", token.ErrInvalid
+	}
+
+	current, err := h.sessions.Generation(c.Request.Context(), email)
+	if errors.Is(err, srverrors.ErrorNotFound) {
+		return "", errSessionRevoked
+	}
+	if err != nil {
+		return "", err
+	}
+	if generation != current {
+		return "", errSessionRevoked
+	}
+
+	return email, nil
+}
+
+func (h *ManageHandler) setSessionCookie(c *gin.Context, value string, maxAge int) {
+	// Strict keeps other sites from acting with the session.
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(SessionCookie, value, maxAge, "/api/manage", "", h.config.SecureCookie, true)
+}
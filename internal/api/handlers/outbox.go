@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"weather/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OutboxStatsStore interface {
+	Stats(ctx context.Context) (models.OutboxStats, error)
+}
+
+type OutboxHandler struct {
+	store OutboxStatsStore
+}
+
+func NewOutboxHandler(store OutboxStatsStore) *OutboxHandler {
+	return &OutboxHandler{
+		store: store,
+	}
+}
+
+func (h *OutboxHandler) Stats(c *gin.Context) {
+	stats, err := h.store.Stats(c.Request.Context())
+	if err != nil {
+		logErrorF(err, "can't count outbox messages")
+		c.JSON(http.StatusInternalServerError, "Can't count outbox messages")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
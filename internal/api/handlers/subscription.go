@@ -2,46 +2,123 @@ package handlers
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
+	"html/template"
 	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+	"weather/internal/i18n"
+	"weather/internal/mailer"
 	"weather/internal/models"
 	"weather/internal/srverrors"
+	"weather/internal/token"
 
 	"github.com/gin-gonic/gin"
 )
 
 type SubscriptionStore interface {
-	Create(context.Context, *models.Subscription) error
+	Create(ctx context.Context, sub *models.Subscription, confirmation models.OutboxMessage) error
+	RenewConfirmToken(
+		ctx context.Context,
+		email, city, frequency, confirmToken string,
+		expiresAt time.Time,
+		confirmation func(models.Subscription) (models.OutboxMessage, error),
+	) error
 	Confirm(ctx context.Context, token string) (models.Subscription, error)
 	Unsubscribe(ctx context.Context, token string) (models.Subscription, error)
+	Cancel(ctx context.Context, token string) (models.Subscription, error)
+	Pause(ctx context.Context, token string) (models.Subscription, error)
+	Resume(ctx context.Context, token string) (models.Subscription, error)
+	GetByToken(ctx context.Context, token string) (models.Subscription, error)
+	Update(ctx context.Context, token string, changes models.SubscriptionChanges) (models.Subscription, error)
 }
 
-type EmailSender interface {
-	SendEmail(to, subject, body string) (err error)
+// ConfirmationThrottle limits confirmation resends per email.
+type ConfirmationThrottle interface {
+	AllowConfirmationRequest(ctx context.Context, email string, interval time.Duration) (bool, error)
+}
+
+type EmailQueue interface {
+	Message(email mailer.Email) models.OutboxMessage
+	Enqueue(ctx context.Context, emails ...mailer.Email) error
+}
+
+type EmailBuilder interface {
+	BuildConfirmationEmail(sub models.Subscription) (mailer.Email, error)
+	BuildUnsubscribeEmail(sub models.Subscription) (mailer.Email, error)
+}
+
+type TokenSigner interface {
+	Unsubscribe(salt string) string
 }
 
 type SubscriptionTargetManager interface {
 	AddTarget(sub models.Subscription)
-	RemoveTarget(email string, frequency string)
+	RemoveTarget(id int64)
 }
 
 type SubscriptionHandler struct {
 	store         SubscriptionStore
 	targetManager SubscriptionTargetManager
-	emailSender   EmailSender
+	emailQueue    EmailQueue
+	emailBuilder  EmailBuilder
+	signer        TokenSigner
+	throttle      ConfirmationThrottle
+
+	confirmationTTL time.Duration
+	resendInterval  time.Duration
 }
 
 type subscribeRequest struct {
 	Email     string `json:"email"`
 	City      string `json:"city"`
 	Frequency string `json:"frequency"`
+	Language  string `json:"language"`
+}
+
+var errInvalidSubscribeRequest = errors.New("invalid subscribe request")
+
+// validate rejects values that would end up in email headers unsafely:
+// anything but a bare address and cities with control characters.
+func (r subscribeRequest) validate() error {
+	addr, err := mail.ParseAddress(r.Email)
+	if err != nil || addr.Address != r.Email {
+		return errInvalidSubscribeRequest
+	}
+
+	if !validCity(r.City) || !validFrequency(r.Frequency) {
+		return errInvalidSubscribeRequest
+	}
+
+	if r.Language != "" && !i18n.Supported(r.Language) {
+		return errInvalidSubscribeRequest
+	}
+
+	return nil
+}
+
+// validateChanges applies the subscribe rules to the changed preferences.
+func validateChanges(changes models.SubscriptionChanges) error {
+	switch {
+	case changes.City != nil && !validCity(*changes.City),
+		changes.Frequency != nil && !validFrequency(*changes.Frequency),
+		changes.Units != nil && *changes.Units != models.UnitsMetric && *changes.Units != models.UnitsImperial,
+		changes.Language != nil && !i18n.Supported(*changes.Language),
+		changes.DeliveryHour != nil && (*changes.DeliveryHour < 0 || *changes.DeliveryHour > 23):
+		return errInvalidSubscribeRequest
+	}
+
+	return nil
+}
+
+func validCity(city string) bool {
+	return strings.TrimSpace(city) != "" && strings.IndexFunc(city, unicode.IsControl) < 0
 }
 
-func sha256Token(input string) string {
-	sum := sha256.Sum256([]byte(input))
-	return hex.EncodeToString(sum[:])
+func validFrequency(frequency string) bool {
+	return frequency == models.Hourly || frequency == models.Daily
 }
 
 func validateToken(c *gin.Context) (string, error) {
@@ -55,16 +132,51 @@ func validateToken(c *gin.Context) (string, error) {
 
 func NewSubscriptionHandler(
 	store SubscriptionStore,
-	emailSender EmailSender,
+	emailQueue EmailQueue,
+	emailBuilder EmailBuilder,
+	signer TokenSigner,
 	targetManager SubscriptionTargetManager,
+	throttle ConfirmationThrottle,
+	confirmationTTL time.Duration,
+	resendInterval time.Duration,
 ) *SubscriptionHandler {
 	return &SubscriptionHandler{
-		store:         store,
-		emailSender:   emailSender,
-		targetManager: targetManager,
+		store:           store,
+		emailQueue:      emailQueue,
+		emailBuilder:    emailBuilder,
+		signer:          signer,
+		targetManager:   targetManager,
+		throttle:        throttle,
+		confirmationTTL: confirmationTTL,
+		resendInterval:  resendInterval,
 	}
 }
 
+// newSubscription issues a random confirmation token and the salt
+// the unsubscribe token is derived from.
+func (s *SubscriptionHandler) newSubscription(req subscribeRequest) (models.Subscription, error) {
+	confirmToken, err := token.Generate()
+	if err != nil {
+		return models.Subscription{}, err
+	}
+
+	salt, err := token.Generate()
+	if err != nil {
+		return models.Subscription{}, err
+	}
+
+	return models.Subscription{
+		Email:                 req.Email,
+		City:                  req.City,
+		Frequency:             req.Frequency,
+		Language:              req.Language,
+		UnsubscribeSalt:       salt,
+		ConfirmationExpiresAt: time.Now().Add(s.confirmationTTL),
+		ConfirmToken:          confirmToken,
+		UnsubscribeToken:      s.signer.Unsubscribe(salt),
+	}, nil
+}
+
 func (s *SubscriptionHandler) Subscribe(c *gin.Context) {
 	var req subscribeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -73,32 +185,103 @@ func (s *SubscriptionHandler) Subscribe(c *gin.Context) {
 		return
 	}
 
-	subscription := models.Subscription{
-		Email:     req.Email,
-		City:      req.City,
-		Frequency: req.Frequency,
-		Token:     sha256Token(req.Email + req.City + req.Frequency),
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	if req.Language == "" {
+		req.Language = i18n.Match(c.GetHeader("Accept-Language"))
+	}
+
+	subscription, err := s.newSubscription(req)
+	if err != nil {
+		logErrorF(err, "can't generate subscription tokens")
+		c.JSON(http.StatusInternalServerError, "Can't create subscription")
+		return
+	}
+
+	confirmation, err := s.emailBuilder.BuildConfirmationEmail(subscription)
+	if err != nil {
+		logErrorF(err, "can't build confirmation email")
+		c.JSON(http.StatusInternalServerError, "Can't create subscription")
+		return
 	}
 
-	err := s.store.Create(c.Request.Context(), &subscription)
+	err = s.store.Create(c.Request.Context(), &subscription, s.emailQueue.Message(confirmation))
 	if err != nil {
 		logErrorF(err, "can't create subscription")
-		if errors.Is(err, srverrors.ErrorAlreadyExists) {
-			c.JSON(http.StatusConflict, "Email already subscribed")
-		} else {
+		switch {
+		case errors.Is(err, srverrors.ErrorPaused):
+			c.JSON(http.StatusConflict, "Subscription is paused, resume it from a forecast email or a manage link")
+		case errors.Is(err, srverrors.ErrorAlreadyExists):
+			c.JSON(http.StatusConflict, "Subscription already active")
+		default:
 			c.JSON(http.StatusInternalServerError, "Can't create subscription")
 		}
 		return
 	}
 
-	err = s.emailSender.SendEmail(subscription.Email, "Your token", subscription.Token)
+	c.JSON(http.StatusOK, "Subscription successful. Confirmation email sent.")
+}
+
+// ResendConfirmation queues the confirmation email of a pending subscription
+// again. The response is the same whether there is one or not, so it doesn't
+// reveal pending subscriptions; for the same reason every address is
+// throttled.
+func (s *SubscriptionHandler) ResendConfirmation(c *gin.Context) {
+	var req subscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logErrorF(err, "cant bind request to json")
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	if err := req.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	allowed, err := s.throttle.AllowConfirmationRequest(c.Request.Context(), req.Email, s.resendInterval)
 	if err != nil {
-		logErrorF(err, "failed to send confirmation email")
-		c.JSON(http.StatusInternalServerError, "Can't send email")
+		logErrorF(err, "can't throttle confirmation resend")
+		c.JSON(http.StatusInternalServerError, "Can't resend confirmation")
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusTooManyRequests, "A confirmation email was requested recently, please check your inbox or try again later")
 		return
 	}
 
-	c.JSON(http.StatusOK, "Subscription successful. Confirmation email sent.")
+	confirmToken, err := token.Generate()
+	if err != nil {
+		logErrorF(err, "can't generate confirmation token")
+		c.JSON(http.StatusInternalServerError, "Can't resend confirmation")
+		return
+	}
+
+	err = s.store.RenewConfirmToken(
+		c.Request.Context(),
+		req.Email,
+		req.City,
+		req.Frequency,
+		confirmToken,
+		time.Now().Add(s.confirmationTTL),
+		func(sub models.Subscription) (models.OutboxMessage, error) {
+			confirmation, err := s.emailBuilder.BuildConfirmationEmail(sub)
+			if err != nil {
+				return models.OutboxMessage{}, err
+			}
+			return s.emailQueue.Message(confirmation), nil
+		},
+	)
+	if err != nil && !errors.Is(err, srverrors.ErrorNotFound) {
+		logErrorF(err, "can't resend confirmation")
+		c.JSON(http.StatusInternalServerError, "Can't resend confirmation")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, "If a matching subscription is pending, a new confirmation email is on its way.")
 }
 
 func (s *SubscriptionHandler) Confirm(c *gin.Context) {
@@ -111,7 +294,16 @@ func (s *SubscriptionHandler) Confirm(c *gin.Context) {
 	sub, err := s.store.Confirm(c.Request.Context(), token)
 	if err != nil {
 		logErrorF(err, "can't confirm subscription")
-		c.JSON(http.StatusNotFound, "Can't confirm subscription")
+		switch {
+		case errors.Is(err, srverrors.ErrorTokenExpired):
+			c.JSON(http.StatusGone, "Confirmation link expired, please subscribe again")
+		case errors.Is(err, srverrors.ErrorInvalidTransition):
+			c.JSON(http.StatusConflict, "Subscription is not pending confirmation")
+		case errors.Is(err, srverrors.ErrorNotFound):
+			c.JSON(http.StatusNotFound, "Can't confirm subscription")
+		default:
+			c.JSON(http.StatusInternalServerError, "Can't confirm subscription")
+		}
 		return
 	}
 
@@ -130,11 +322,186 @@ func (s *SubscriptionHandler) Unsubscribe(c *gin.Context) {
 	sub, err := s.store.Unsubscribe(c.Request.Context(), token)
 	if err != nil {
 		logErrorF(err, "can't cancel subscription")
-		c.JSON(http.StatusNotFound, "Can't cancel subscription")
+		switch {
+		case errors.Is(err, srverrors.ErrorInvalidTransition):
+			c.JSON(http.StatusConflict, "Subscription is not active")
+		case errors.Is(err, srverrors.ErrorNotFound):
+			c.JSON(http.StatusNotFound, "Can't cancel subscription")
+		default:
+			c.JSON(http.StatusInternalServerError, "Can't cancel subscription")
+		}
 		return
 	}
 
-	s.targetManager.RemoveTarget(sub.Email, sub.Frequency)
+	s.targetManager.RemoveTarget(sub.ID)
+
+	farewell, err := s.emailBuilder.BuildUnsubscribeEmail(sub)
+	if err == nil {
+		err = s.emailQueue.Enqueue(c.Request.Context(), farewell)
+	}
+	if err != nil {
+		logErrorF(err, "failed to queue unsubscribe email")
+	}
 
 	c.JSON(http.StatusOK, "Unsubscribed successfully")
 }
+
+// cancelPage asks before cancelling, so link scanners following the link
+// in the confirmation email don't cancel subscriptions. The form posts
+// back to the same URL.
+var cancelPage = template.Must(template.New("cancel").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Cancel subscription request</title></head>
+<body>
+<p>Someone asked to send weather forecasts to your email. If it wasn't you, cancel the request.</p>
+<form method="post">
+<button type="submit">Cancel the subscription request</button>
+</form>
+</body>
+</html>
+`))
+
+// ConfirmCancel renders the page that posts to Cancel.
+func (s *SubscriptionHandler) ConfirmCancel(c *gin.Context) {
+	if _, err := validateToken(c); err != nil {
+		c.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := cancelPage.Execute(c.Writer, nil); err != nil {
+		logErrorF(err, "can't render cancel page")
+	}
+}
+
+// Cancel deletes a pending subscription requested by someone else
+// on behalf of the email owner.
+func (s *SubscriptionHandler) Cancel(c *gin.Context) {
+	token, err := validateToken(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	if _, err := s.store.Cancel(c.Request.Context(), token); err != nil {
+		logErrorF(err, "can't cancel pending subscription")
+		if errors.Is(err, srverrors.ErrorNotFound) {
+			c.JSON(http.StatusNotFound, "Pending subscription not found")
+		} else {
+			c.JSON(http.StatusInternalServerError, "Can't cancel subscription")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, "Subscription request cancelled")
+}
+
+// Get shows the subscription the unsubscribe token from forecast emails belongs to.
+func (s *SubscriptionHandler) Get(c *gin.Context) {
+	token, err := validateToken(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	sub, err := s.store.GetByToken(c.Request.Context(), token)
+	if err != nil {
+		logErrorF(err, "can't get subscription")
+		if errors.Is(err, srverrors.ErrorNotFound) {
+			c.JSON(http.StatusNotFound, "Subscription not found")
+		} else {
+			c.JSON(http.StatusInternalServerError, "Can't get subscription")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// Update changes the preferences of an active or paused subscription.
+func (s *SubscriptionHandler) Update(c *gin.Context) {
+	token, err := validateToken(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	var changes models.SubscriptionChanges
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		logErrorF(err, "cant bind request to json")
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	if err := validateChanges(changes); err != nil {
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	sub, err := s.store.Update(c.Request.Context(), token, changes)
+	if err != nil {
+		logErrorF(err, "can't update subscription")
+		switch {
+		case errors.Is(err, srverrors.ErrorAlreadyExists):
+			c.JSON(http.StatusConflict, "Subscription for this city and frequency already exists")
+		case errors.Is(err, srverrors.ErrorInvalidTransition):
+			c.JSON(http.StatusConflict, "Subscription is not active")
+		case errors.Is(err, srverrors.ErrorNotFound):
+			c.JSON(http.StatusNotFound, "Subscription not found")
+		default:
+			c.JSON(http.StatusInternalServerError, "Can't update subscription")
+		}
+		return
+	}
+
+	if sub.Status == models.StatusActive {
+		s.targetManager.AddTarget(sub)
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+func (s *SubscriptionHandler) Pause(c *gin.Context) {
+	s.changeStatus(c, s.store.Pause, "Subscription is not active")
+}
+
+func (s *SubscriptionHandler) Resume(c *gin.Context) {
+	s.changeStatus(c, s.store.Resume, "Subscription is not paused")
+}
+
+// changeStatus performs a status transition and keeps the mailing targets
+// in line with the resulting status.
+func (s *SubscriptionHandler) changeStatus(
+	c *gin.Context,
+	transition func(ctx context.Context, token string) (models.Subscription, error),
+	invalidMessage string,
+) {
+	token, err := validateToken(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	sub, err := transition(c.Request.Context(), token)
+	if err != nil {
+		logErrorF(err, "can't change subscription status")
+		switch {
+		case errors.Is(err, srverrors.ErrorInvalidTransition):
+			c.JSON(http.StatusConflict, invalidMessage)
+		case errors.Is(err, srverrors.ErrorNotFound):
+			c.JSON(http.StatusNotFound, "Subscription not found")
+		default:
+			c.JSON(http.StatusInternalServerError, "Can't change subscription status")
+		}
+		return
+	}
+
+	if sub.Status == models.StatusActive {
+		s.targetManager.AddTarget(sub)
+	} else {
+		s.targetManager.RemoveTarget(sub.ID)
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
@@ -1,6 +1,10 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
 
 func ExtractParam(key string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -31,3 +35,23 @@ func ExtractQuery(key string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// ExtractBearer reads a bearer token from the Authorization header,
+// falling back to the cookie, and stores it under key.
+func ExtractBearer(key, cookie string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || value == "" {
+			value, _ = c.Cookie(cookie)
+		}
+
+		if value == "" {
+			c.Next()
+			return
+		}
+
+		c.Set(key, value)
+
+		c.Next()
+	}
+}
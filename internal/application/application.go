@@ -9,9 +9,12 @@ import (
 	"syscall"
 	"time"
 	"weather/internal/api"
+	"weather/internal/api/handlers"
 	"weather/internal/config"
+	"weather/internal/janitor"
 	"weather/internal/mailer"
 	"weather/internal/store"
+	"weather/internal/token"
 	"weather/internal/weather"
 
 	"github.com/gin-gonic/gin"
@@ -20,12 +23,16 @@ import (
 const shutdownTimeout = 5 * time.Second
 
 type Application struct {
-	Config         config.ApplicationConfig
-	Store          store.Storage
-	Router         *gin.Engine
-	server         *http.Server
-	WeatherService *weather.RemoteService
-	MailerService  *mailer.Manager
+	Config             config.ApplicationConfig
+	SubscriptionConfig config.SubscriptionConfig
+	ManageConfig       config.ManageConfig
+	Store              store.Storage
+	Router             *gin.Engine
+	server             *http.Server
+	WeatherService     *weather.RemoteService
+	MailerService      *mailer.Manager
+	Signer             *token.Signer
+	Janitor            *janitor.Janitor
 }
 
 func (a *Application) Initialize() {
@@ -37,12 +44,22 @@ func (a *Application) Initialize() {
 		IdleTimeout:  a.Config.IdleTimeout,
 	}
 
+	mailbox, _ := a.MailerService.Mailer.(handlers.Mailbox)
+
 	api.Mount(
 		a.Router,
 		a.Store.Subscription,
 		a.WeatherService,
-		a.MailerService.Mailer,
+		a.MailerService.Outbox,
+		a.MailerService.Builder,
+		a.Signer,
 		a.MailerService.Targets,
+		a.Store.Privacy,
+		a.Store.Session,
+		a.Store.Outbox,
+		mailbox,
+		a.SubscriptionConfig,
+		a.ManageConfig,
 	)
 }
 
@@ -51,6 +68,7 @@ func (a *Application) Run() {
 	a.Initialize()
 
 	a.MailerService.Start()
+	a.Janitor.Start()
 
 	go func() {
 		log.Printf("Starting server on %s", a.Config.Addr)
@@ -64,6 +82,7 @@ func (a *Application) Run() {
 	<-quit
 
 	log.Println("Shutting down server...")
+	a.Janitor.Stop()
 	a.MailerService.Stop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
@@ -5,10 +5,12 @@ import (
 )
 
 type ApplicationConfig struct {
-	Addr         string
-	WriteTimeout time.Duration
-	ReadTimeout  time.Duration
-	IdleTimeout  time.Duration
+	Mode          string
+	Addr          string
+	PublicBaseURL string
+	WriteTimeout  time.Duration
+	ReadTimeout   time.Duration
+	IdleTimeout   time.Duration
 }
 
 type DBConfig struct {
@@ -21,11 +23,92 @@ type DBConfig struct {
 type WeatherAPIConfig struct {
 	ServiceBaseURL string
 	APIKey         string
+	CacheTTL       time.Duration
 }
 
 type SMTPConfig struct {
-	SMTPUser     string
-	SMTPPassword string
-	SMTPHost     string
-	SMTPPort     string
+	SMTPUser           string
+	SMTPPassword       string
+	SMTPHost           string
+	SMTPPort           string
+	Security           string
+	AuthMechanism      string
+	EnvelopeFrom       string
+	FromAddress        string
+	FromName           string
+	PoolSize           int
+	IdleTimeout        time.Duration
+	MaxMessagesPerConn int
+}
+
+type FakeWeatherConfig struct {
+	Addr      string
+	APIKey    string
+	Seed      int64
+	FixedTime time.Time
+}
+
+type MailerConfig struct {
+	Workers   int
+	QueueSize int
+}
+
+type HTTPTransportConfig struct {
+	URL     string
+	APIKey  string
+	Timeout time.Duration
+}
+
+type FileTransportConfig struct {
+	Format string
+	Path   string
+}
+
+type MailTransportConfig struct {
+	Kind            string
+	HTTP            HTTPTransportConfig
+	File            FileTransportConfig
+	SandboxCapacity int
+}
+
+type OutboxConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Lease        time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	// SentRetention is how long sent messages are kept; zero keeps them.
+	SentRetention time.Duration
+}
+
+type SubscriptionConfig struct {
+	ConfirmationTTL time.Duration
+	TokenSecret     string
+	JanitorInterval time.Duration
+	// ReminderBefore is how long before expiry a pending subscription is
+	// reminded about; zero disables reminders.
+	ReminderBefore time.Duration
+	// ResendInterval is the minimum time between confirmation resends to
+	// one email.
+	ResendInterval time.Duration
+}
+
+type ManageConfig struct {
+	LinkTTL    time.Duration
+	SessionTTL time.Duration
+	// LinkInterval is the minimum time between login links to one email.
+	LinkInterval time.Duration
+	// SecureCookie limits the session cookie to HTTPS.
+	SecureCookie bool
+}
+
+type EncryptionConfig struct {
+	// Keys are comma-separated id:base64 AES-256 keys; KeyID picks the one
+	// new values are encrypted with.
+	Keys     string
+	KeyID    string
+	IndexKey string
+	// BatchSize is how many rows a re-encryption transaction changes.
+	BatchSize int
 }
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	joinErr "errors"
+
+	"github.com/pkg/errors"
+)
+
+// migrationsLockID keys the advisory lock held while migrating, so replicas
+// starting together apply each migration once.
+const migrationsLockID = 7_310_251_049
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	ErrSchemaNewer = errors.New("database schema is newer than this binary")
+	ErrDirty       = errors.New("database schema is dirty")
+	ErrNoChange    = errors.New("no migration to apply")
+)
+
+type Migration struct {
+	Version uint
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus is the schema version recorded in the database. Dirty
+// means a migration failed half way and must be fixed by hand.
+type MigrationStatus struct {
+	Version uint
+	Dirty   bool
+	Latest  uint
+	Pending []Migration
+}
+
+// Migrator applies the embedded migrations. It keeps the version in the
+// schema_migrations table of golang-migrate, so databases migrated with
+// its CLI carry on where it stopped.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// loadMigrations reads files named <version>_<name>.(up|down).sql.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read migrations")
+	}
+
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		versionPart, name, found := strings.Cut(base, "_")
+		if !ok || !found || (direction != "up" && direction != "down") {
+			return nil, errors.Errorf("unexpected migration file %s", entry.Name())
+		}
+
+		version, err := strconv.ParseUint(versionPart, 10, 32)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid migration version in %s", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read migration %s", entry.Name())
+		}
+
+		m, exists := byVersion[uint(version)]
+		if !exists {
+			m = &Migration{Version: uint(version), Name: name}
+			byVersion[uint(version)] = m
+		}
+		if direction == "up" {
+			m.up = string(content)
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, errors.Errorf("migration %d has no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Latest is the version of the newest embedded migration.
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status reads the schema version without changing the database or
+// waiting for a running migration. A database without schema_migrations
+// is at version 0.
+func (m *Migrator) Status(ctx context.Context) (MigrationStatus, error) {
+	var exists bool
+	err := m.db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL;`).Scan(&exists)
+	if err != nil {
+		return MigrationStatus{Latest: m.Latest()}, errors.Wrap(err, "failed to look up schema_migrations")
+	}
+	if !exists {
+		return m.pending(MigrationStatus{Latest: m.Latest()}), nil
+	}
+
+	return m.read(ctx, m.db)
+}
+
+// Up applies every pending migration. It refuses to run against a schema
+// newer than the embedded migrations, which an older binary can't use.
+func (m *Migrator) Up(ctx context.Context) (applied []Migration, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		status, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := status.Check(); err != nil {
+			return err
+		}
+
+		for _, migration := range status.Pending {
+			if err := m.apply(ctx, conn, migration.up, migration.Version); err != nil {
+				return errors.Wrapf(err, "migration %d_%s failed", migration.Version, migration.Name)
+			}
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts up to steps of the most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []Migration, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		status, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := status.Check(); err != nil {
+			return err
+		}
+		if status.Version == 0 {
+			return ErrNoChange
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if migration.Version > status.Version {
+				continue
+			}
+			if migration.down == "" {
+				return errors.Errorf("migration %d_%s can't be reverted", migration.Version, migration.Name)
+			}
+
+			var previous uint
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+			if err := m.apply(ctx, conn, migration.down, previous); err != nil {
+				return errors.Wrapf(err, "reverting migration %d_%s failed", migration.Version, migration.Name)
+			}
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// status creates schema_migrations if needed and reads the version, on the
+// connection holding the migrations lock.
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) (MigrationStatus, error) {
+	const query = `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL);`
+
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return MigrationStatus{Latest: m.Latest()}, errors.Wrap(err, "failed to create schema_migrations")
+	}
+
+	return m.read(ctx, conn)
+}
+
+// read reads the version from schema_migrations, which must exist.
+func (m *Migrator) read(ctx context.Context, db interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}) (MigrationStatus, error) {
+	const query = `SELECT version, dirty FROM schema_migrations LIMIT 1;`
+
+	status := MigrationStatus{Latest: m.Latest()}
+
+	var version int64
+	err := db.QueryRowContext(ctx, query).Scan(&version, &status.Dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return status, errors.Wrap(err, "failed to read schema version")
+	}
+	status.Version = uint(version)
+
+	return m.pending(status), nil
+}
+
+// pending lists the migrations not applied yet. It lists none when the
+// schema is newer than the binary.
+func (m *Migrator) pending(status MigrationStatus) MigrationStatus {
+	for _, migration := range m.migrations {
+		if migration.Version > status.Version {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	return status
+}
+
+// Check rejects schemas the embedded migrations can't safely change.
+func (s MigrationStatus) Check() error {
+	if s.Dirty {
+		return errors.Wrapf(ErrDirty, "version %d", s.Version)
+	}
+	if s.Version > s.Latest {
+		return errors.Wrapf(ErrSchemaNewer, "database is at version %d, binary knows %d", s.Version, s.Latest)
+	}
+
+	return nil
+}
+
+// apply runs the migration and records the new version in one transaction.
+// Version 0 means no migration is applied.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, query string, version uint) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations;`); err != nil {
+		return errors.Wrap(err, "failed to clear schema version")
+	}
+	if version > 0 {
+		if _, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false);`, version); err != nil {
+			return errors.Wrap(err, "failed to record schema version")
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit migration")
+}
+
+// locked runs fn on a connection holding the migrations advisory lock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get connection")
+	}
+
+	defer func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			err = joinErr.Join(err, errors.Wrap(closeErr, "failed to close connection"))
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrationsLockID); err != nil {
+		return errors.Wrap(err, "failed to acquire migrations lock")
+	}
+
+	defer func() {
+		// A cancelled ctx would leave the lock to the pooled connection.
+		if _, unlockErr := conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1);`, migrationsLockID); unlockErr != nil {
+			err = joinErr.Join(err, errors.Wrap(unlockErr, "failed to release migrations lock"))
+		}
+	}()
+
+	return fn(conn)
+}
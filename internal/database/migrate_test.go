@@ -0,0 +1,132 @@
+package database
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+	tests := []struct {
+		name         string
+		files        fstest.MapFS
+		wantVersions []uint
+		wantErr      bool
+	}{
+		{name: "empty", files: fstest.MapFS{"migrations": &fstest.MapFile{Mode: fs.ModeDir}}, wantVersions: []uint{}},
+		{
+			name: "numeric order",
+			files: fstest.MapFS{
+				"migrations/10_add_index.up.sql":    file("CREATE INDEX;"),
+				"migrations/10_add_index.down.sql":  file("DROP INDEX;"),
+				"migrations/2_add_column.up.sql":    file("ALTER TABLE;"),
+				"migrations/000001_create.up.sql":   file("CREATE TABLE;"),
+				"migrations/000001_create.down.sql": file("DROP TABLE;"),
+			},
+			wantVersions: []uint{1, 2, 10},
+		},
+		{
+			name:    "missing up file",
+			files:   fstest.MapFS{"migrations/000001_create.down.sql": file("DROP TABLE;")},
+			wantErr: true,
+		},
+		{
+			name:    "empty up file",
+			files:   fstest.MapFS{"migrations/000001_create.up.sql": file("")},
+			wantErr: true,
+		},
+		{
+			name:    "unknown direction",
+			files:   fstest.MapFS{"migrations/000001_create.sideways.sql": file("SELECT 1;")},
+			wantErr: true,
+		},
+		{
+			name:    "no name",
+			files:   fstest.MapFS{"migrations/000001.up.sql": file("SELECT 1;")},
+			wantErr: true,
+		},
+		{
+			name:    "bad version",
+			files:   fstest.MapFS{"migrations/first_create.up.sql": file("SELECT 1;")},
+			wantErr: true,
+		},
+		{
+			name:    "missing directory",
+			files:   fstest.MapFS{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files, "migrations")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadMigrations error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			versions := make([]uint, 0, len(migrations))
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			if len(versions) != len(tt.wantVersions) {
+				t.Fatalf("versions = %v, want %v", versions, tt.wantVersions)
+			}
+			for i := range versions {
+				if versions[i] != tt.wantVersions[i] {
+					t.Fatalf("versions = %v, want %v", versions, tt.wantVersions)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+
+	for i, m := range migrations {
+		if m.Version != uint(i+1) {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.down == "" {
+			t.Errorf("migration %d has no down file", m.Version)
+		}
+	}
+}
+
+func TestMigrationStatus(t *testing.T) {
+	m := &Migrator{migrations: []Migration{{Version: 1}, {Version: 2}, {Version: 3}}}
+
+	tests := []struct {
+		name        string
+		status      MigrationStatus
+		wantPending int
+		wantErr     error
+	}{
+		{name: "fresh", status: MigrationStatus{Version: 0, Latest: 3}, wantPending: 3},
+		{name: "behind", status: MigrationStatus{Version: 2, Latest: 3}, wantPending: 1},
+		{name: "current", status: MigrationStatus{Version: 3, Latest: 3}},
+		{name: "dirty", status: MigrationStatus{Version: 2, Dirty: true, Latest: 3}, wantPending: 1, wantErr: ErrDirty},
+		{name: "newer", status: MigrationStatus{Version: 4, Latest: 3}, wantErr: ErrSchemaNewer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := m.pending(tt.status)
+			if len(status.Pending) != tt.wantPending {
+				t.Errorf("pending = %d migrations, want %d", len(status.Pending), tt.wantPending)
+			}
+			if err := status.Check(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
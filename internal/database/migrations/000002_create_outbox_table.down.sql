@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS weather."outbox_status_idx";
+DROP INDEX IF EXISTS weather."outbox_due_idx";
+
+DROP TABLE IF EXISTS weather.outbox;
+
+DROP TYPE IF EXISTS weather.outbox_status;
@@ -0,0 +1,26 @@
+CREATE TYPE weather.outbox_status AS ENUM (
+    'pending',
+    'sending',
+    'sent',
+    'dead'
+);
+
+CREATE TABLE IF NOT EXISTS weather.outbox (
+    id              bigserial PRIMARY KEY,
+    recipient       character varying(255)                 NOT NULL,
+    subject         text                                   NOT NULL,
+    body            text                                   NOT NULL,
+    status          weather.outbox_status DEFAULT 'pending' NOT NULL,
+    attempts        integer DEFAULT 0                      NOT NULL,
+    max_attempts    integer DEFAULT 8                      NOT NULL,
+    next_attempt_at timestamp with time zone DEFAULT now() NOT NULL,
+    locked_until    timestamp with time zone,
+    last_error      text,
+    created_at      timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at      timestamp with time zone DEFAULT now() NOT NULL,
+    sent_at         timestamp with time zone
+);
+
+CREATE INDEX IF NOT EXISTS "outbox_due_idx" ON weather.outbox("next_attempt_at")
+    WHERE status IN ('pending', 'sending');
+CREATE INDEX IF NOT EXISTS "outbox_status_idx" ON weather.outbox("status");
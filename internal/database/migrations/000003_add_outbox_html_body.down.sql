@@ -0,0 +1 @@
+ALTER TABLE weather.outbox DROP COLUMN IF EXISTS html_body;
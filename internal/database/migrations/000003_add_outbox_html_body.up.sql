@@ -0,0 +1 @@
+ALTER TABLE weather.outbox ADD COLUMN IF NOT EXISTS html_body text DEFAULT '' NOT NULL;
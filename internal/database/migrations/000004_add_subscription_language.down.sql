@@ -0,0 +1 @@
+ALTER TABLE weather.subscriptions DROP COLUMN IF EXISTS language;
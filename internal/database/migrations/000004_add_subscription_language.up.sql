@@ -0,0 +1 @@
+ALTER TABLE weather.subscriptions ADD COLUMN IF NOT EXISTS language character varying(8) DEFAULT 'en' NOT NULL;
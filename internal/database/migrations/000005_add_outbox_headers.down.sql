@@ -0,0 +1 @@
+ALTER TABLE weather.outbox DROP COLUMN IF EXISTS headers;
@@ -0,0 +1 @@
+ALTER TABLE weather.outbox ADD COLUMN IF NOT EXISTS headers jsonb DEFAULT '{}' NOT NULL;
@@ -0,0 +1,19 @@
+-- Plain tokens can't be recovered, so rows get a placeholder token
+-- and every link sent since the upgrade stops working.
+ALTER TABLE weather.subscriptions ADD COLUMN IF NOT EXISTS token character varying(255);
+
+UPDATE weather.subscriptions
+SET token = COALESCE(legacy_token_hash, unsubscribe_token_hash, confirm_token_hash, id::text);
+
+ALTER TABLE weather.subscriptions
+    ALTER COLUMN token SET NOT NULL,
+    ADD CONSTRAINT subscriptions_token_key UNIQUE (token);
+
+CREATE INDEX IF NOT EXISTS "token_idx" ON weather.subscriptions("token");
+
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS confirm_token_hash,
+    DROP COLUMN IF EXISTS unsubscribe_token_hash,
+    DROP COLUMN IF EXISTS unsubscribe_salt,
+    DROP COLUMN IF EXISTS legacy_token_hash,
+    DROP COLUMN IF EXISTS legacy_token_expires_at;
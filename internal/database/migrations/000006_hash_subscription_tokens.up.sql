@@ -0,0 +1,15 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS confirm_token_hash      character(64) UNIQUE,
+    ADD COLUMN IF NOT EXISTS unsubscribe_token_hash  character(64) UNIQUE,
+    ADD COLUMN IF NOT EXISTS unsubscribe_salt        character varying(64),
+    ADD COLUMN IF NOT EXISTS legacy_token_hash       character(64) UNIQUE,
+    ADD COLUMN IF NOT EXISTS legacy_token_expires_at timestamp with time zone;
+
+-- Links already sent keep working for a grace period. Unsubscribe salts of
+-- existing rows are assigned by the service on startup, as they need its secret.
+UPDATE weather.subscriptions
+SET legacy_token_hash = encode(sha256(convert_to(token, 'UTF8')), 'hex'),
+    legacy_token_expires_at = now() + interval '30 days';
+
+DROP INDEX IF EXISTS weather.token_idx;
+ALTER TABLE weather.subscriptions DROP COLUMN IF EXISTS token;
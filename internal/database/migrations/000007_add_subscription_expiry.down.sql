@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS weather.subscriptions_pending_expiry_idx;
+
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS confirmation_expires_at,
+    DROP COLUMN IF EXISTS reminder_sent_at;
@@ -0,0 +1,13 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS created_at              timestamp with time zone DEFAULT now() NOT NULL,
+    ADD COLUMN IF NOT EXISTS confirmation_expires_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS reminder_sent_at        timestamp with time zone;
+
+-- Pending rows from before the upgrade get the default confirmation window.
+UPDATE weather.subscriptions
+SET confirmation_expires_at = now() + interval '48 hours'
+WHERE confirmed = false;
+
+CREATE INDEX IF NOT EXISTS subscriptions_pending_expiry_idx
+    ON weather.subscriptions (confirmation_expires_at)
+    WHERE confirmed = false;
@@ -0,0 +1,19 @@
+ALTER TABLE weather.subscriptions ADD COLUMN IF NOT EXISTS confirmed boolean DEFAULT false NOT NULL;
+
+-- Paused subscriptions are kept as confirmed, everything else as unconfirmed.
+UPDATE weather.subscriptions
+SET confirmed = status IN ('active', 'paused');
+
+DROP INDEX IF EXISTS weather.subscriptions_status_idx;
+DROP INDEX IF EXISTS weather.subscriptions_pending_expiry_idx;
+CREATE INDEX IF NOT EXISTS subscriptions_pending_expiry_idx
+    ON weather.subscriptions (confirmation_expires_at)
+    WHERE confirmed = false;
+
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS confirmed_at,
+    DROP COLUMN IF EXISTS unsubscribed_at,
+    DROP COLUMN IF EXISTS updated_at;
+
+DROP TYPE IF EXISTS weather.subscription_status;
@@ -0,0 +1,43 @@
+CREATE TYPE weather.subscription_status AS ENUM (
+    'pending',
+    'active',
+    'paused',
+    'unsubscribed',
+    'bounced'
+);
+
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS status          weather.subscription_status DEFAULT 'pending' NOT NULL,
+    ADD COLUMN IF NOT EXISTS confirmed_at    timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS unsubscribed_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS updated_at      timestamp with time zone DEFAULT now() NOT NULL;
+
+-- Confirming clears the confirmation window, so an unconfirmed row without
+-- one was unsubscribed. Rows unsubscribed before the window was introduced
+-- can't be told apart from pending ones and stay pending until they expire.
+UPDATE weather.subscriptions
+SET status = CASE
+        WHEN confirmed THEN 'active'
+        WHEN confirmation_expires_at IS NULL THEN 'unsubscribed'
+        ELSE 'pending'
+    END::weather.subscription_status,
+    confirmed_at = CASE WHEN confirmed THEN created_at END,
+    unsubscribed_at = CASE WHEN NOT confirmed AND confirmation_expires_at IS NULL THEN now() END;
+
+-- Those rows still carry their legacy token, which Confirm accepts and which
+-- would re-activate an unsubscribed row. Rows created since tokens were
+-- randomized have none, so clearing it on pending rows only affects rows
+-- from before the upgrade; their owners subscribe again if they were pending.
+UPDATE weather.subscriptions
+SET legacy_token_hash = NULL,
+    legacy_token_expires_at = NULL
+WHERE status = 'pending' AND legacy_token_hash IS NOT NULL;
+
+DROP INDEX IF EXISTS weather.subscriptions_pending_expiry_idx;
+CREATE INDEX IF NOT EXISTS subscriptions_pending_expiry_idx
+    ON weather.subscriptions (confirmation_expires_at)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS subscriptions_status_idx ON weather.subscriptions (status);
+
+ALTER TABLE weather.subscriptions DROP COLUMN IF EXISTS confirmed;
@@ -0,0 +1,2 @@
+ALTER TABLE weather.subscriptions DROP COLUMN IF EXISTS delivery_hour;
+ALTER TABLE weather.subscriptions DROP COLUMN IF EXISTS units;
@@ -0,0 +1,6 @@
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS units         character varying(8) DEFAULT 'metric' NOT NULL
+        CHECK (units IN ('metric', 'imperial')),
+    -- Hour of the day daily forecasts are sent at, in the server time zone.
+    ADD COLUMN IF NOT EXISTS delivery_hour smallint DEFAULT 0 NOT NULL
+        CHECK (delivery_hour BETWEEN 0 AND 23);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS weather.outbox_recipient_idx;
+DROP TABLE IF EXISTS weather.audit_events;
@@ -0,0 +1,12 @@
+-- Events outlive the subscriptions they describe, e.g. cancelled ones,
+-- so they reference them without a foreign key.
+CREATE TABLE IF NOT EXISTS weather.audit_events (
+    id              bigserial PRIMARY KEY,
+    email           character varying(255)                 NOT NULL,
+    subscription_id bigint,
+    event           character varying(32)                  NOT NULL,
+    created_at      timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS "audit_events_email_idx" ON weather.audit_events("email");
+CREATE INDEX IF NOT EXISTS "outbox_recipient_idx" ON weather.outbox("recipient");
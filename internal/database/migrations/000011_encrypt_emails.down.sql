@@ -0,0 +1,31 @@
+-- Encrypted emails can't be decrypted here: restoring NOT NULL fails until
+-- they are written back in plaintext, instead of dropping them silently.
+ALTER TABLE weather.audit_events ALTER COLUMN email SET NOT NULL;
+DROP INDEX IF EXISTS weather.audit_events_email_hash_idx;
+CREATE INDEX IF NOT EXISTS "audit_events_email_idx" ON weather.audit_events("email");
+ALTER TABLE weather.audit_events DROP COLUMN IF EXISTS email_hash;
+
+ALTER TABLE weather.outbox
+    ALTER COLUMN recipient SET NOT NULL,
+    ALTER COLUMN body SET NOT NULL,
+    ALTER COLUMN html_body SET DEFAULT '',
+    ALTER COLUMN html_body SET NOT NULL;
+DROP INDEX IF EXISTS weather.outbox_key_id_idx;
+DROP INDEX IF EXISTS weather.outbox_recipient_hash_idx;
+CREATE INDEX IF NOT EXISTS "outbox_recipient_idx" ON weather.outbox("recipient");
+ALTER TABLE weather.outbox
+    DROP COLUMN IF EXISTS recipient_hash,
+    DROP COLUMN IF EXISTS recipient_ciphertext,
+    DROP COLUMN IF EXISTS body_ciphertext,
+    DROP COLUMN IF EXISTS html_body_ciphertext,
+    DROP COLUMN IF EXISTS key_id;
+
+ALTER TABLE weather.subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_email_check,
+    DROP CONSTRAINT IF EXISTS subscriptions_email_hash_city_frequency_key,
+    ALTER COLUMN email SET NOT NULL;
+DROP INDEX IF EXISTS weather.subscriptions_email_key_id_idx;
+ALTER TABLE weather.subscriptions
+    DROP COLUMN IF EXISTS email_hash,
+    DROP COLUMN IF EXISTS email_ciphertext,
+    DROP COLUMN IF EXISTS email_key_id;
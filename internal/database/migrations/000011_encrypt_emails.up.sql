@@ -0,0 +1,33 @@
+-- Emails are encrypted by the application, which also fills the columns
+-- for existing rows and clears the plaintext ones on start.
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS email_hash       character(64),
+    ADD COLUMN IF NOT EXISTS email_ciphertext bytea,
+    ADD COLUMN IF NOT EXISTS email_key_id     character varying(32),
+    ALTER COLUMN email DROP NOT NULL,
+    ADD CONSTRAINT subscriptions_email_hash_city_frequency_key UNIQUE (email_hash, city, frequency),
+    ADD CONSTRAINT subscriptions_email_check CHECK (email IS NOT NULL OR email_ciphertext IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS "subscriptions_email_key_id_idx" ON weather.subscriptions("email_key_id");
+
+ALTER TABLE weather.outbox
+    ADD COLUMN IF NOT EXISTS recipient_hash       character(64),
+    ADD COLUMN IF NOT EXISTS recipient_ciphertext bytea,
+    ADD COLUMN IF NOT EXISTS body_ciphertext      bytea,
+    ADD COLUMN IF NOT EXISTS html_body_ciphertext bytea,
+    ADD COLUMN IF NOT EXISTS key_id               character varying(32),
+    ALTER COLUMN recipient DROP NOT NULL,
+    ALTER COLUMN body DROP NOT NULL,
+    ALTER COLUMN html_body DROP NOT NULL,
+    ALTER COLUMN html_body DROP DEFAULT;
+
+DROP INDEX IF EXISTS weather.outbox_recipient_idx;
+CREATE INDEX IF NOT EXISTS "outbox_recipient_hash_idx" ON weather.outbox("recipient_hash");
+CREATE INDEX IF NOT EXISTS "outbox_key_id_idx" ON weather.outbox("key_id");
+
+ALTER TABLE weather.audit_events
+    ADD COLUMN IF NOT EXISTS email_hash character(64),
+    ALTER COLUMN email DROP NOT NULL;
+
+DROP INDEX IF EXISTS weather.audit_events_email_idx;
+CREATE INDEX IF NOT EXISTS "audit_events_email_hash_idx" ON weather.audit_events("email_hash");
@@ -0,0 +1 @@
+ALTER TABLE weather.subscriptions DROP COLUMN IF EXISTS previous_confirm_token_hash;
@@ -0,0 +1,3 @@
+-- The confirmation link sent before a reminder keeps working until expiry.
+ALTER TABLE weather.subscriptions
+    ADD COLUMN IF NOT EXISTS previous_confirm_token_hash character(64) UNIQUE;
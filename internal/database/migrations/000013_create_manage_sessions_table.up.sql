@@ -0,0 +1,11 @@
+-- Management sessions carry the generation of their email; bumping it on
+-- logout or erasure revokes every session issued before. Rows also
+-- throttle login link requests and are keyed by the blind index only.
+CREATE TABLE IF NOT EXISTS weather.manage_sessions (
+    email_hash        character(64) PRIMARY KEY,
+    generation        integer       DEFAULT 0 NOT NULL,
+    link_requested_at timestamp with time zone,
+    updated_at        timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS "manage_sessions_updated_at_idx" ON weather.manage_sessions("updated_at");
@@ -0,0 +1 @@
+ALTER TABLE weather.manage_sessions DROP COLUMN IF EXISTS confirmation_requested_at;
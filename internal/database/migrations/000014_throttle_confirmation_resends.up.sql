@@ -0,0 +1,4 @@
+-- Resending a confirmation is throttled per email like login links, for
+-- every address whether it has a pending subscription or not.
+ALTER TABLE weather.manage_sessions
+    ADD COLUMN IF NOT EXISTS confirmation_requested_at timestamp with time zone;
@@ -0,0 +1,144 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KeySize is the size of AES-256 keys and of the blind index key.
+const KeySize = 32
+
+var (
+	ErrUnknownKey = errors.New("unknown encryption key")
+	ErrNoIndexKey = errors.New("blind index key is empty")
+	ErrZeroKey    = errors.New("key is all zeros")
+)
+
+// Keyring encrypts values with AES-GCM under the current key and decrypts
+// them with any known key, identified by the key ID stored next to the
+// ciphertext. Retired keys stay in the keyring until no row uses them.
+type Keyring struct {
+	current  string
+	aeads    map[string]cipher.AEAD
+	indexKey []byte
+}
+
+// NewKeyring builds a keyring from keys by ID, encrypting with the current one.
+// The index key derives blind indexes and can't be rotated without
+// recomputing every index.
+func NewKeyring(keys map[string][]byte, current string, indexKey []byte) (*Keyring, error) {
+	if len(indexKey) == 0 {
+		return nil, ErrNoIndexKey
+	}
+	if isZero(indexKey) {
+		return nil, errors.Wrap(ErrZeroKey, "blind index key")
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, errors.Wrapf(ErrUnknownKey, "current key %q", current)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if len(key) != KeySize {
+			return nil, errors.Errorf("encryption key %q must be %d bytes, got %d", id, KeySize, len(key))
+		}
+		if isZero(key) {
+			return nil, errors.Wrapf(ErrZeroKey, "encryption key %q", id)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid encryption key %q", id)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid encryption key %q", id)
+		}
+		aeads[id] = aead
+	}
+
+	return &Keyring{current: current, aeads: aeads, indexKey: indexKey}, nil
+}
+
+// isZero catches placeholder keys, which would encrypt with a known key.
+func isZero(key []byte) bool {
+	return bytes.Equal(key, make([]byte, len(key)))
+}
+
+// ParseKeys parses a comma-separated list of id:base64-key pairs.
+func ParseKeys(value string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, errors.Errorf("encryption key %q must be in id:base64 form", pair)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encryption key %q is not valid base64", id)
+		}
+		keys[id] = key
+	}
+
+	return keys, nil
+}
+
+// KeyID identifies the key Encrypt uses.
+func (k *Keyring) KeyID() string {
+	return k.current
+}
+
+// Encrypt seals the value with the current key, prefixing the random nonce.
+func (k *Keyring) Encrypt(plaintext string) ([]byte, error) {
+	aead := k.aeads[k.current]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "unable to generate nonce")
+	}
+
+	return aead.Seal(nonce, nonce, []byte(plaintext), nil), nil
+}
+
+func (k *Keyring) Decrypt(keyID string, ciphertext []byte) (string, error) {
+	aead, ok := k.aeads[keyID]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownKey, "key %q", keyID)
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return "", errors.New("ciphertext is too short")
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to decrypt with key %q", keyID)
+	}
+
+	return string(plaintext), nil
+}
+
+// BlindIndex returns the keyed hash used to look up and deduplicate
+// encrypted values without decrypting them.
+func (k *Keyring) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
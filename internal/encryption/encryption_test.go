@@ -0,0 +1,195 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestParseKeys(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKey(1))
+
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "one key", value: "k1:" + encoded, want: []string{"k1"}},
+		{name: "two keys with spaces", value: "k1:" + encoded + " , k2:" + encoded, want: []string{"k1", "k2"}},
+		{name: "missing ID", value: ":" + encoded, wantErr: true},
+		{name: "missing separator", value: encoded, wantErr: true},
+		{name: "invalid base64", value: "k1:not base64", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseKeys(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeys error = %v, want error %t", err, tt.wantErr)
+			}
+			if len(keys) != len(tt.want) {
+				t.Fatalf("ParseKeys returned %d keys, want %d", len(keys), len(tt.want))
+			}
+			for _, id := range tt.want {
+				if !bytes.Equal(keys[id], testKey(1)) {
+					t.Errorf("key %q = %x", id, keys[id])
+				}
+			}
+		})
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     map[string][]byte
+		current  string
+		indexKey []byte
+		wantErr  error
+	}{
+		{name: "valid", keys: map[string][]byte{"k1": testKey(1)}, current: "k1", indexKey: testKey(9)},
+		{name: "no index key", keys: map[string][]byte{"k1": testKey(1)}, current: "k1", wantErr: ErrNoIndexKey},
+		{name: "zero index key", keys: map[string][]byte{"k1": testKey(1)}, current: "k1", indexKey: testKey(0), wantErr: ErrZeroKey},
+		{name: "unknown current key", keys: map[string][]byte{"k1": testKey(1)}, current: "k2", indexKey: testKey(9), wantErr: ErrUnknownKey},
+		{name: "no keys", current: "k1", indexKey: testKey(9), wantErr: ErrUnknownKey},
+		{name: "zero key", keys: map[string][]byte{"k1": testKey(0)}, current: "k1", indexKey: testKey(9), wantErr: ErrZeroKey},
+		{
+			name:     "zero retired key",
+			keys:     map[string][]byte{"k1": testKey(0), "k2": testKey(2)},
+			current:  "k2",
+			indexKey: testKey(9),
+			wantErr:  ErrZeroKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.keys, tt.current, tt.indexKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewKeyring error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("short key", func(t *testing.T) {
+		if _, err := NewKeyring(map[string][]byte{"k1": testKey(1)[:16]}, "k1", testKey(9)); err == nil {
+			t.Error("NewKeyring accepted a 16-byte key")
+		}
+	})
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	keyring, err := NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", testKey(9))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	for _, plaintext := range []string{"", "user@example.com", "користувач@приклад.укр"} {
+		ciphertext, err := keyring.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plaintext, err)
+		}
+		if plaintext != "" && bytes.Contains(ciphertext, []byte(plaintext)) {
+			t.Errorf("ciphertext of %q contains the plaintext", plaintext)
+		}
+
+		again, err := keyring.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plaintext, err)
+		}
+		if bytes.Equal(ciphertext, again) {
+			t.Errorf("Encrypt(%q) isn't randomized", plaintext)
+		}
+
+		got, err := keyring.Decrypt("k1", ciphertext)
+		if err != nil {
+			t.Fatalf("Decrypt(%q): %v", plaintext, err)
+		}
+		if got != plaintext {
+			t.Errorf("Decrypt = %q, want %q", got, plaintext)
+		}
+	}
+
+	ciphertext, err := keyring.Encrypt("user@example.com")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	tampered := bytes.Clone(ciphertext)
+	tampered[len(tampered)-1] ^= 1
+
+	failures := []struct {
+		name       string
+		keyID      string
+		ciphertext []byte
+	}{
+		{name: "tampered", keyID: "k1", ciphertext: tampered},
+		{name: "too short", keyID: "k1", ciphertext: ciphertext[:4]},
+		{name: "unknown key", keyID: "k2", ciphertext: ciphertext},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keyring.Decrypt(tt.keyID, tt.ciphertext); err == nil {
+				t.Error("Decrypt succeeded")
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	indexKey := testKey(9)
+
+	before, err := NewKeyring(map[string][]byte{"k1": testKey(1)}, "k1", indexKey)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	during, err := NewKeyring(map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, "k2", indexKey)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	after, err := NewKeyring(map[string][]byte{"k2": testKey(2)}, "k2", indexKey)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	old, err := before.Encrypt("user@example.com")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	// Rows written before the rotation stay readable until re-encrypted.
+	plaintext, err := during.Decrypt(before.KeyID(), old)
+	if err != nil || plaintext != "user@example.com" {
+		t.Fatalf("Decrypt of an old row = %q, %v", plaintext, err)
+	}
+
+	if during.KeyID() != "k2" {
+		t.Errorf("KeyID = %q, want k2", during.KeyID())
+	}
+	reencrypted, err := during.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	if _, err := after.Decrypt("k1", old); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with a removed key error = %v, want %v", err, ErrUnknownKey)
+	}
+	if plaintext, err := after.Decrypt(during.KeyID(), reencrypted); err != nil || plaintext != "user@example.com" {
+		t.Errorf("Decrypt of a re-encrypted row = %q, %v", plaintext, err)
+	}
+
+	// The blind index doesn't depend on the encryption key.
+	if before.BlindIndex("user@example.com") != after.BlindIndex("user@example.com") {
+		t.Error("BlindIndex changed with the encryption key")
+	}
+	if before.BlindIndex("user@example.com") == before.BlindIndex("other@example.com") {
+		t.Error("BlindIndex collides for different values")
+	}
+}
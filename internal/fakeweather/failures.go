@@ -0,0 +1,136 @@
+package fakeweather
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ModeNotFound    = "not_found"
+	ModeRateLimit   = "rate_limit"
+	ModeServerError = "server_error"
+	ModeSlow        = "slow"
+)
+
+var ErrUnknownMode = errors.New("unknown failure mode")
+
+// FailureRule makes matching requests misbehave. An empty City matches
+// every city and a zero Remaining keeps the rule active until it is cleared.
+type FailureRule struct {
+	ID        int64  `json:"id"`
+	Mode      string `json:"mode"`
+	City      string `json:"city,omitempty"`
+	Status    int    `json:"status,omitempty"`
+	DelayMs   int    `json:"delay_ms,omitempty"`
+	Remaining int    `json:"remaining,omitempty"`
+}
+
+func (r FailureRule) validate() error {
+	switch r.Mode {
+	case ModeNotFound, ModeRateLimit, ModeServerError:
+		return nil
+	case ModeSlow:
+		if r.DelayMs <= 0 {
+			return errors.New("slow mode requires a positive delay")
+		}
+		return nil
+	default:
+		return errors.Wrap(ErrUnknownMode, r.Mode)
+	}
+}
+
+func (r FailureRule) delay() time.Duration {
+	return time.Duration(r.DelayMs) * time.Millisecond
+}
+
+func (r FailureRule) status() int {
+	if r.Status != 0 {
+		return r.Status
+	}
+
+	switch r.Mode {
+	case ModeNotFound:
+		// weatherapi.com reports unknown locations as 400 with code 1006.
+		return http.StatusBadRequest
+	case ModeRateLimit:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (r FailureRule) body() errorResponse {
+	switch r.Mode {
+	case ModeNotFound:
+		return errorResponse{Error: apiError{Code: errCodeNoLocation, Message: "No matching location found."}}
+	case ModeRateLimit:
+		return errorResponse{Error: apiError{Code: errCodeQuotaExceeded, Message: "API key has exceeded calls per month quota."}}
+	default:
+		return errorResponse{Error: apiError{Code: errCodeInternal, Message: "Internal application error."}}
+	}
+}
+
+type Failures struct {
+	mx     sync.Mutex
+	nextID int64
+	rules  []FailureRule
+}
+
+func (f *Failures) Add(rule FailureRule) (FailureRule, error) {
+	if err := rule.validate(); err != nil {
+		return FailureRule{}, err
+	}
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.nextID++
+	rule.ID = f.nextID
+	rule.City = normalize(rule.City)
+	f.rules = append(f.rules, rule)
+
+	return rule, nil
+}
+
+func (f *Failures) List() []FailureRule {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	copied := make([]FailureRule, len(f.rules))
+	copy(copied, f.rules)
+	return copied
+}
+
+func (f *Failures) Clear() {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.rules = nil
+}
+
+// Match consumes and returns the first rule that applies to the city.
+func (f *Failures) Match(city string) (FailureRule, bool) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	key := normalize(city)
+	for i, rule := range f.rules {
+		if rule.City != "" && rule.City != key {
+			continue
+		}
+
+		if rule.Remaining > 0 {
+			f.rules[i].Remaining--
+			if f.rules[i].Remaining == 0 {
+				f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			}
+		}
+
+		return rule, true
+	}
+
+	return FailureRule{}, false
+}
@@ -0,0 +1,400 @@
+package fakeweather
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	dateLayout     = "2006-01-02"
+	dateTimeLayout = "2006-01-02 15:04"
+	maxForecastDay = 14
+)
+
+type place struct {
+	name    string
+	region  string
+	country string
+	lat     float64
+	lon     float64
+	tz      string
+}
+
+var knownPlaces = []place{
+	{"Kyiv", "Kyyivs'ka Oblast'", "Ukraine", 50.43, 30.52, "Europe/Kyiv"},
+	{"Lviv", "L'vivs'ka Oblast'", "Ukraine", 49.83, 24.00, "Europe/Kyiv"},
+	{"Odesa", "Odes'ka Oblast'", "Ukraine", 46.47, 30.73, "Europe/Kyiv"},
+	{"Kharkiv", "Kharkivs'ka Oblast'", "Ukraine", 50.00, 36.25, "Europe/Kyiv"},
+	{"Dnipro", "Dnipropetrovs'ka Oblast'", "Ukraine", 48.45, 34.98, "Europe/Kyiv"},
+	{"Zaporizhzhia", "Zaporiz'ka Oblast'", "Ukraine", 47.82, 35.18, "Europe/Kyiv"},
+	{"Warsaw", "Mazowieckie", "Poland", 52.25, 21.00, "Europe/Warsaw"},
+	{"Berlin", "Berlin", "Germany", 52.52, 13.40, "Europe/Berlin"},
+	{"London", "City of London, Greater London", "United Kingdom", 51.52, -0.11, "Europe/London"},
+	{"Paris", "Ile-de-France", "France", 48.87, 2.33, "Europe/Paris"},
+	{"New York", "New York", "United States of America", 40.71, -74.01, "America/New_York"},
+	{"Tokyo", "Tokyo", "Japan", 35.69, 139.69, "Asia/Tokyo"},
+}
+
+type conditionKind struct {
+	code  int
+	day   string
+	night string
+	icon  int
+	rainy bool
+}
+
+// A subset of https://www.weatherapi.com/docs/weather_conditions.json
+// ordered from the driest to the wettest.
+var conditions = []conditionKind{
+	{1000, "Sunny", "Clear", 113, false},
+	{1003, "Partly cloudy", "Partly cloudy", 116, false},
+	{1006, "Cloudy", "Cloudy", 119, false},
+	{1009, "Overcast", "Overcast", 122, false},
+	{1030, "Mist", "Mist", 143, false},
+	{1063, "Patchy rain possible", "Patchy rain possible", 176, true},
+	{1183, "Light rain", "Light rain", 296, true},
+	{1189, "Moderate rain", "Moderate rain", 302, true},
+	{1195, "Heavy rain", "Heavy rain", 308, true},
+	{1087, "Thundery outbreaks possible", "Thundery outbreaks possible", 200, true},
+}
+
+var snowConditions = []conditionKind{
+	{1066, "Patchy snow possible", "Patchy snow possible", 179, true},
+	{1213, "Light snow", "Light snow", 326, true},
+	{1219, "Moderate snow", "Moderate snow", 332, true},
+}
+
+var windDirections = []string{
+	"N", "NNE", "NE", "ENE", "E", "ESE", "SE", "SSE",
+	"S", "SSW", "SW", "WSW", "W", "WNW", "NW", "NNW",
+}
+
+// Generator produces synthetic weather that is a pure function
+// of the seed, the city and the hour being described.
+type Generator struct {
+	seed int64
+}
+
+func NewGenerator(seed int64) *Generator {
+	return &Generator{seed: seed}
+}
+
+func (g *Generator) Seed() int64 {
+	return g.seed
+}
+
+func normalize(city string) string {
+	return strings.ToLower(strings.Join(strings.Fields(city), " "))
+}
+
+// noise returns a deterministic value in [0, 1) for the given parts.
+func (g *Generator) noise(parts ...string) float64 {
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%d", g.seed)
+	for _, p := range parts {
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(p))
+	}
+
+	return float64(h.Sum64()>>11) / float64(1<<53)
+}
+
+func (g *Generator) lookup(city string) place {
+	key := normalize(city)
+	for _, p := range knownPlaces {
+		if normalize(p.name) == key {
+			return p
+		}
+	}
+
+	name := strings.Join(strings.Fields(city), " ")
+	if first, size := utf8.DecodeRuneInString(name); size > 0 {
+		name = string(unicode.ToUpper(first)) + name[size:]
+	}
+
+	return place{
+		name:    name,
+		region:  "Synthetic Region",
+		country: "Fakeland",
+		lat:     math.Round((g.noise(key, "lat")*140-70)*100) / 100,
+		lon:     math.Round((g.noise(key, "lon")*360-180)*100) / 100,
+		tz:      "UTC",
+	}
+}
+
+func (g *Generator) zone(p place) *time.Location {
+	loc, err := time.LoadLocation(p.tz)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+func (g *Generator) location(p place, at time.Time) location {
+	local := at.In(g.zone(p))
+
+	return location{
+		Name:           p.name,
+		Region:         p.region,
+		Country:        p.country,
+		Lat:            p.lat,
+		Lon:            p.lon,
+		TzID:           p.tz,
+		LocaltimeEpoch: local.Unix(),
+		Localtime:      local.Format(dateTimeLayout),
+	}
+}
+
+// sample describes the weather of a city during one local hour.
+type sample struct {
+	tempC    float64
+	humidity int
+	cloud    int
+	windKph  float64
+	windDeg  int
+	precipMm float64
+	rainPct  int
+	uv       float64
+	isDay    bool
+	cond     conditionKind
+}
+
+func (g *Generator) sample(p place, at time.Time) sample {
+	key := normalize(p.name)
+	local := at.In(g.zone(p)).Truncate(time.Hour)
+	date := local.Format(dateLayout)
+	stamp := local.Format(dateTimeLayout)
+
+	// A yearly cycle shifted by latitude plus a daily cycle peaking at 15:00.
+	season := math.Cos(2 * math.Pi * float64(local.YearDay()-200) / 365)
+	if p.lat < 0 {
+		season = -season
+	}
+	climate := 22 - math.Abs(p.lat)*0.35 + g.noise(key, "climate")*6
+	daily := -math.Cos(2*math.Pi*float64(local.Hour()-3)/24) * 4
+	temp := climate + season*12 + daily + (g.noise(key, date, "temp")-0.5)*6
+
+	wetness := g.noise(key, date, "wet")*0.7 + g.noise(key, stamp, "wet")*0.3
+	humidity := 35 + int(wetness*60)
+
+	kinds := conditions
+	if temp < 1 && wetness > 0.5 {
+		kinds = snowConditions
+		wetness = (wetness - 0.5) * 2
+	}
+	idx := int(wetness * float64(len(kinds)))
+	if idx >= len(kinds) {
+		idx = len(kinds) - 1
+	}
+	cond := kinds[idx]
+
+	isDay := local.Hour() >= 6 && local.Hour() < 20
+	precip := 0.0
+	if cond.rainy {
+		precip = math.Round(wetness*40) / 10
+	}
+
+	uv := 0.0
+	if isDay {
+		uv = math.Round((1-wetness)*(season+1.2)*40) / 10
+	}
+
+	return sample{
+		tempC:    math.Round(temp*10) / 10,
+		humidity: humidity,
+		cloud:    int(wetness * 100),
+		windKph:  math.Round(g.noise(key, stamp, "wind")*350) / 10,
+		windDeg:  int(g.noise(key, date, "dir") * 360),
+		precipMm: precip,
+		rainPct:  int(wetness * 100),
+		uv:       uv,
+		isDay:    isDay,
+		cond:     cond,
+	}
+}
+
+func (s sample) condition() condition {
+	text, period := s.cond.night, "night"
+	if s.isDay {
+		text, period = s.cond.day, "day"
+	}
+
+	return condition{
+		Text: text,
+		Icon: fmt.Sprintf("//cdn.weatherapi.com/weather/64x64/%s/%d.png", period, s.cond.icon),
+		Code: s.cond.code,
+	}
+}
+
+func celsiusToFahrenheit(c float64) float64 {
+	return math.Round((c*9/5+32)*10) / 10
+}
+
+func kphToMph(kph float64) float64 {
+	return math.Round(kph/1.609344*10) / 10
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func (g *Generator) current(p place, at time.Time) current {
+	s := g.sample(p, at)
+	updated := at.In(g.zone(p)).Truncate(15 * time.Minute)
+	feels := math.Round((s.tempC-s.windKph/10)*10) / 10
+	pressure := math.Round(1000 + g.noise(normalize(p.name), updated.Format(dateLayout), "pressure")*30)
+
+	return current{
+		LastUpdatedEpoch: updated.Unix(),
+		LastUpdated:      updated.Format(dateTimeLayout),
+		TempC:            s.tempC,
+		TempF:            celsiusToFahrenheit(s.tempC),
+		IsDay:            boolToInt(s.isDay),
+		Condition:        s.condition(),
+		WindMph:          kphToMph(s.windKph),
+		WindKph:          s.windKph,
+		WindDegree:       s.windDeg,
+		WindDir:          windDirections[(s.windDeg*len(windDirections)/360)%len(windDirections)],
+		PressureMb:       pressure,
+		PressureIn:       math.Round(pressure*0.02953*100) / 100,
+		PrecipMm:         s.precipMm,
+		PrecipIn:         math.Round(s.precipMm*0.03937*100) / 100,
+		Humidity:         s.humidity,
+		Cloud:            s.cloud,
+		FeelslikeC:       feels,
+		FeelslikeF:       celsiusToFahrenheit(feels),
+		VisKm:            math.Round((10-float64(s.cloud)/20)*10) / 10,
+		VisMiles:         math.Round((6-float64(s.cloud)/33)*10) / 10,
+		UV:               s.uv,
+	}
+}
+
+func (g *Generator) forecastDay(p place, date time.Time) forecastDay {
+	result := forecastDay{
+		Date:      date.Format(dateLayout),
+		DateEpoch: date.Unix(),
+		Astro:     astro{Sunrise: "06:00 AM", Sunset: "08:00 PM"},
+		Hour:      make([]hour, 0, 24),
+	}
+
+	minTemp, maxTemp := math.Inf(1), math.Inf(-1)
+	sumTemp, sumHumidity, maxWind, totalPrecip, maxRain, maxUV := 0.0, 0, 0.0, 0.0, 0, 0.0
+	worst := conditions[0]
+
+	for h := 0; h < 24; h++ {
+		at := date.Add(time.Duration(h) * time.Hour)
+		s := g.sample(p, at)
+
+		result.Hour = append(result.Hour, hour{
+			TimeEpoch:    at.Unix(),
+			Time:         at.Format(dateTimeLayout),
+			TempC:        s.tempC,
+			TempF:        celsiusToFahrenheit(s.tempC),
+			IsDay:        boolToInt(s.isDay),
+			Condition:    s.condition(),
+			WindKph:      s.windKph,
+			Humidity:     s.humidity,
+			Cloud:        s.cloud,
+			ChanceOfRain: s.rainPct,
+		})
+
+		minTemp = math.Min(minTemp, s.tempC)
+		maxTemp = math.Max(maxTemp, s.tempC)
+		sumTemp += s.tempC
+		sumHumidity += s.humidity
+		maxWind = math.Max(maxWind, s.windKph)
+		totalPrecip += s.precipMm
+		maxUV = math.Max(maxUV, s.uv)
+		if s.rainPct > maxRain {
+			maxRain = s.rainPct
+			worst = s.cond
+		}
+	}
+
+	avgTemp := math.Round(sumTemp/24*10) / 10
+	result.Day = day{
+		MaxTempC:          maxTemp,
+		MaxTempF:          celsiusToFahrenheit(maxTemp),
+		MinTempC:          minTemp,
+		MinTempF:          celsiusToFahrenheit(minTemp),
+		AvgTempC:          avgTemp,
+		AvgTempF:          celsiusToFahrenheit(avgTemp),
+		MaxWindKph:        maxWind,
+		TotalPrecipMm:     math.Round(totalPrecip*10) / 10,
+		AvgHumidity:       sumHumidity / 24,
+		DailyChanceOfRain: maxRain,
+		Condition:         sample{isDay: true, cond: worst}.condition(),
+		UV:                maxUV,
+	}
+
+	return result
+}
+
+func (g *Generator) Current(city string, at time.Time) currentResponse {
+	p := g.lookup(city)
+
+	return currentResponse{
+		Location: g.location(p, at),
+		Current:  g.current(p, at),
+	}
+}
+
+func (g *Generator) Forecast(city string, days int, at time.Time) forecastResponse {
+	p := g.lookup(city)
+
+	var resp forecastResponse
+	resp.Location = g.location(p, at)
+	resp.Current = g.current(p, at)
+
+	local := at.In(g.zone(p))
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	for d := 0; d < days; d++ {
+		resp.Forecast.ForecastDay = append(resp.Forecast.ForecastDay, g.forecastDay(p, start.AddDate(0, 0, d)))
+	}
+
+	return resp
+}
+
+func (g *Generator) Search(query string) []searchResult {
+	key := normalize(query)
+	results := make([]searchResult, 0)
+
+	for _, p := range knownPlaces {
+		if strings.HasPrefix(normalize(p.name), key) {
+			results = append(results, g.searchResult(p))
+		}
+	}
+
+	if len(results) == 0 {
+		results = append(results, g.searchResult(g.lookup(query)))
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	return results
+}
+
+func (g *Generator) searchResult(p place) searchResult {
+	slug := strings.ReplaceAll(normalize(p.name+" "+p.country), " ", "-")
+
+	return searchResult{
+		ID:      int64(g.noise(normalize(p.name), "id") * 1e7),
+		Name:    p.name,
+		Region:  p.region,
+		Country: p.country,
+		Lat:     p.lat,
+		Lon:     p.lon,
+		URL:     slug,
+	}
+}
@@ -0,0 +1,125 @@
+package fakeweather
+
+type condition struct {
+	Text string `json:"text"`
+	Icon string `json:"icon"`
+	Code int    `json:"code"`
+}
+
+type location struct {
+	Name           string  `json:"name"`
+	Region         string  `json:"region"`
+	Country        string  `json:"country"`
+	Lat            float64 `json:"lat"`
+	Lon            float64 `json:"lon"`
+	TzID           string  `json:"tz_id"`
+	LocaltimeEpoch int64   `json:"localtime_epoch"`
+	Localtime      string  `json:"localtime"`
+}
+
+type current struct {
+	LastUpdatedEpoch int64     `json:"last_updated_epoch"`
+	LastUpdated      string    `json:"last_updated"`
+	TempC            float64   `json:"temp_c"`
+	TempF            float64   `json:"temp_f"`
+	IsDay            int       `json:"is_day"`
+	Condition        condition `json:"condition"`
+	WindMph          float64   `json:"wind_mph"`
+	WindKph          float64   `json:"wind_kph"`
+	WindDegree       int       `json:"wind_degree"`
+	WindDir          string    `json:"wind_dir"`
+	PressureMb       float64   `json:"pressure_mb"`
+	PressureIn       float64   `json:"pressure_in"`
+	PrecipMm         float64   `json:"precip_mm"`
+	PrecipIn         float64   `json:"precip_in"`
+	Humidity         int       `json:"humidity"`
+	Cloud            int       `json:"cloud"`
+	FeelslikeC       float64   `json:"feelslike_c"`
+	FeelslikeF       float64   `json:"feelslike_f"`
+	VisKm            float64   `json:"vis_km"`
+	VisMiles         float64   `json:"vis_miles"`
+	UV               float64   `json:"uv"`
+}
+
+type hour struct {
+	TimeEpoch    int64     `json:"time_epoch"`
+	Time         string    `json:"time"`
+	TempC        float64   `json:"temp_c"`
+	TempF        float64   `json:"temp_f"`
+	IsDay        int       `json:"is_day"`
+	Condition    condition `json:"condition"`
+	WindKph      float64   `json:"wind_kph"`
+	Humidity     int       `json:"humidity"`
+	Cloud        int       `json:"cloud"`
+	ChanceOfRain int       `json:"chance_of_rain"`
+}
+
+type day struct {
+	MaxTempC          float64   `json:"maxtemp_c"`
+	MaxTempF          float64   `json:"maxtemp_f"`
+	MinTempC          float64   `json:"mintemp_c"`
+	MinTempF          float64   `json:"mintemp_f"`
+	AvgTempC          float64   `json:"avgtemp_c"`
+	AvgTempF          float64   `json:"avgtemp_f"`
+	MaxWindKph        float64   `json:"maxwind_kph"`
+	TotalPrecipMm     float64   `json:"totalprecip_mm"`
+	AvgHumidity       int       `json:"avghumidity"`
+	DailyChanceOfRain int       `json:"daily_chance_of_rain"`
+	Condition         condition `json:"condition"`
+	UV                float64   `json:"uv"`
+}
+
+type astro struct {
+	Sunrise string `json:"sunrise"`
+	Sunset  string `json:"sunset"`
+}
+
+type forecastDay struct {
+	Date      string `json:"date"`
+	DateEpoch int64  `json:"date_epoch"`
+	Day       day    `json:"day"`
+	Astro     astro  `json:"astro"`
+	Hour      []hour `json:"hour"`
+}
+
+type currentResponse struct {
+	Location location `json:"location"`
+	Current  current  `json:"current"`
+}
+
+type forecastResponse struct {
+	Location location `json:"location"`
+	Current  current  `json:"current"`
+	Forecast struct {
+		ForecastDay []forecastDay `json:"forecastday"`
+	} `json:"forecast"`
+}
+
+type searchResult struct {
+	ID      int64   `json:"id"`
+	Name    string  `json:"name"`
+	Region  string  `json:"region"`
+	Country string  `json:"country"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	URL     string  `json:"url"`
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+// Error codes documented by weatherapi.com.
+const (
+	errCodeKeyMissing    = 1002
+	errCodeQueryMissing  = 1003
+	errCodeNoLocation    = 1006
+	errCodeKeyInvalid    = 2006
+	errCodeQuotaExceeded = 2007
+	errCodeInternal      = 9999
+)
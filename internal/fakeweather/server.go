@@ -0,0 +1,181 @@
+package fakeweather
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"weather/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Server struct {
+	mx        sync.RWMutex
+	generator *Generator
+	failures  *Failures
+	apiKey    string
+	now       func() time.Time
+}
+
+func NewServer(config config.FakeWeatherConfig) *Server {
+	now := time.Now
+	if !config.FixedTime.IsZero() {
+		fixed := config.FixedTime
+		now = func() time.Time { return fixed }
+	}
+
+	return &Server{
+		generator: NewGenerator(config.Seed),
+		failures:  &Failures{},
+		apiKey:    config.APIKey,
+		now:       now,
+	}
+}
+
+func (s *Server) Mount(router *gin.Engine) {
+	v1 := router.Group("/v1")
+	v1.Use(s.authorize, s.requireQuery, s.injectFailures)
+	{
+		v1.GET("/current.json", s.Current)
+		v1.GET("/forecast.json", s.Forecast)
+		v1.GET("/search.json", s.Search)
+	}
+
+	admin := router.Group("/admin")
+	{
+		admin.GET("/state", s.State)
+		admin.PUT("/seed", s.SetSeed)
+		admin.POST("/failures", s.AddFailure)
+		admin.DELETE("/failures", s.ClearFailures)
+	}
+}
+
+func (s *Server) gen() *Generator {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.generator
+}
+
+func abortWithError(c *gin.Context, status int, code int, message string) {
+	c.AbortWithStatusJSON(status, errorResponse{Error: apiError{Code: code, Message: message}})
+}
+
+func (s *Server) authorize(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		abortWithError(c, http.StatusUnauthorized, errCodeKeyMissing, "API key is invalid or not provided.")
+		return
+	}
+
+	if s.apiKey != "" && key != s.apiKey {
+		abortWithError(c, http.StatusUnauthorized, errCodeKeyInvalid, "API key provided is invalid")
+		return
+	}
+
+	c.Next()
+}
+
+func (s *Server) requireQuery(c *gin.Context) {
+	if c.Query("q") == "" {
+		abortWithError(c, http.StatusBadRequest, errCodeQueryMissing, "Parameter q is missing.")
+		return
+	}
+
+	c.Next()
+}
+
+func (s *Server) injectFailures(c *gin.Context) {
+	rule, ok := s.failures.Match(c.Query("q"))
+	if !ok {
+		c.Next()
+		return
+	}
+
+	if rule.Mode == ModeSlow {
+		select {
+		case <-time.After(rule.delay()):
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return
+		}
+		c.Next()
+		return
+	}
+
+	c.AbortWithStatusJSON(rule.status(), rule.body())
+}
+
+func (s *Server) Current(c *gin.Context) {
+	c.JSON(http.StatusOK, s.gen().Current(c.Query("q"), s.now()))
+}
+
+func (s *Server) Forecast(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "1"))
+	if err != nil || days < 1 {
+		days = 1
+	}
+	if days > maxForecastDay {
+		days = maxForecastDay
+	}
+
+	c.JSON(http.StatusOK, s.gen().Forecast(c.Query("q"), days, s.now()))
+}
+
+func (s *Server) Search(c *gin.Context) {
+	c.JSON(http.StatusOK, s.gen().Search(c.Query("q")))
+}
+
+type stateResponse struct {
+	Seed     int64         `json:"seed"`
+	Now      time.Time     `json:"now"`
+	Failures []FailureRule `json:"failures"`
+}
+
+func (s *Server) State(c *gin.Context) {
+	c.JSON(http.StatusOK, stateResponse{
+		Seed:     s.gen().Seed(),
+		Now:      s.now(),
+		Failures: s.failures.List(),
+	})
+}
+
+type seedRequest struct {
+	Seed int64 `json:"seed"`
+}
+
+func (s *Server) SetSeed(c *gin.Context) {
+	var req seedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	s.mx.Lock()
+	s.generator = NewGenerator(req.Seed)
+	s.mx.Unlock()
+
+	c.JSON(http.StatusOK, req)
+}
+
+func (s *Server) AddFailure(c *gin.Context) {
+	var req FailureRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, "Invalid input")
+		return
+	}
+
+	rule, err := s.failures.Add(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (s *Server) ClearFailures(c *gin.Context) {
+	s.failures.Clear()
+	c.Status(http.StatusNoContent)
+}
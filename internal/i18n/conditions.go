@@ -0,0 +1,62 @@
+package i18n
+
+// ukrainianConditions translates the condition texts of weatherapi.com,
+// keyed by the lowercased English text.
+var ukrainianConditions = map[string]string{
+	"sunny":                            "Сонячно",
+	"clear":                            "Ясно",
+	"partly cloudy":                    "Мінлива хмарність",
+	"cloudy":                           "Хмарно",
+	"overcast":                         "Похмуро",
+	"mist":                             "Серпанок",
+	"fog":                              "Туман",
+	"freezing fog":                     "Крижаний туман",
+	"patchy rain possible":             "Місцями можливий дощ",
+	"patchy rain nearby":               "Поблизу місцями дощ",
+	"patchy snow possible":             "Місцями можливий сніг",
+	"patchy snow nearby":               "Поблизу місцями сніг",
+	"patchy sleet possible":            "Місцями можливий мокрий сніг",
+	"patchy freezing drizzle possible": "Місцями можлива крижана мряка",
+	"thundery outbreaks possible":      "Можлива гроза",
+	"thundery outbreaks in nearby":     "Поблизу гроза",
+	"blowing snow":                     "Поземок",
+	"blizzard":                         "Хуртовина",
+	"patchy light drizzle":             "Місцями легка мряка",
+	"light drizzle":                    "Легка мряка",
+	"freezing drizzle":                 "Крижана мряка",
+	"heavy freezing drizzle":           "Сильна крижана мряка",
+	"patchy light rain":                "Місцями невеликий дощ",
+	"light rain":                       "Невеликий дощ",
+	"moderate rain at times":           "Часом помірний дощ",
+	"moderate rain":                    "Помірний дощ",
+	"heavy rain at times":              "Часом сильний дощ",
+	"heavy rain":                       "Сильний дощ",
+	"light freezing rain":              "Невеликий крижаний дощ",
+	"moderate or heavy freezing rain":  "Помірний або сильний крижаний дощ",
+	"light sleet":                      "Невеликий мокрий сніг",
+	"moderate or heavy sleet":          "Помірний або сильний мокрий сніг",
+	"patchy light snow":                "Місцями невеликий сніг",
+	"light snow":                       "Невеликий сніг",
+	"patchy moderate snow":             "Місцями помірний сніг",
+	"moderate snow":                    "Помірний сніг",
+	"patchy heavy snow":                "Місцями сильний сніг",
+	"heavy snow":                       "Сильний сніг",
+	"ice pellets":                      "Крижана крупа",
+	"light rain shower":                "Невелика злива",
+	"moderate or heavy rain shower":    "Помірна або сильна злива",
+	"torrential rain shower":           "Проливна злива",
+	"light sleet showers":              "Невеликий мокрий сніг з дощем",
+	"moderate or heavy sleet showers":  "Помірний або сильний мокрий сніг з дощем",
+	"light snow showers":               "Невеликий снігопад",
+	"moderate or heavy snow showers":   "Помірний або сильний снігопад",
+	"light showers of ice pellets":     "Невелика крижана крупа",
+	"moderate or heavy showers of ice pellets":    "Помірна або сильна крижана крупа",
+	"patchy light rain with thunder":              "Місцями невеликий дощ з грозою",
+	"patchy light rain in area with thunder":      "Місцями невеликий дощ з грозою",
+	"moderate or heavy rain with thunder":         "Помірний або сильний дощ з грозою",
+	"moderate or heavy rain in area with thunder": "Помірний або сильний дощ з грозою",
+	"patchy light snow with thunder":              "Місцями невеликий сніг з грозою",
+	"patchy light snow in area with thunder":      "Місцями невеликий сніг з грозою",
+	"moderate or heavy snow with thunder":         "Помірний або сильний сніг з грозою",
+	"moderate or heavy snow in area with thunder": "Помірний або сильний сніг з грозою",
+}
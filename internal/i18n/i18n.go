@@ -0,0 +1,169 @@
+package i18n
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"weather/internal/models"
+)
+
+const (
+	English   = "en"
+	Ukrainian = "uk"
+
+	Default = English
+)
+
+// Locale formats dates, numbers and weather conditions for one language.
+type Locale struct {
+	Language string
+
+	decimalSeparator  string
+	groupSeparator    string
+	unitSeparator     string
+	months            [12]string
+	frequencies       map[string]string
+	conditions        map[string]string
+	dateFormatPattern string
+}
+
+var locales = map[string]*Locale{
+	English: {
+		Language:          English,
+		decimalSeparator:  ".",
+		groupSeparator:    ",",
+		months:            [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		dateFormatPattern: "{month} {day}, {year}",
+	},
+	Ukrainian: {
+		Language:         Ukrainian,
+		decimalSeparator: ",",
+		// Ukrainian groups digits with a non-breaking space.
+		groupSeparator: " ",
+		// The degree sign is separated from the number.
+		unitSeparator: " ",
+		// Genitive month names, as used in a full date.
+		months: [12]string{
+			"січня", "лютого", "березня", "квітня", "травня", "червня",
+			"липня", "серпня", "вересня", "жовтня", "листопада", "грудня",
+		},
+		dateFormatPattern: "{day} {month} {year} р.",
+		frequencies: map[string]string{
+			"hourly": "щогодинні",
+			"daily":  "щоденні",
+		},
+		conditions: ukrainianConditions,
+	},
+}
+
+// Languages lists the supported languages, default first.
+func Languages() []string {
+	return []string{English, Ukrainian}
+}
+
+func Supported(language string) bool {
+	_, ok := locales[language]
+	return ok
+}
+
+// Get returns the locale of the language, falling back to the default one.
+func Get(language string) *Locale {
+	if locale, ok := locales[language]; ok {
+		return locale
+	}
+
+	return locales[Default]
+}
+
+// Match picks the first supported language of an Accept-Language header.
+// Quality values are not weighed; clients list languages by preference.
+func Match(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if Supported(base) {
+			return base
+		}
+	}
+
+	return Default
+}
+
+func (l *Locale) Date(t time.Time) string {
+	return strings.NewReplacer(
+		"{day}", strconv.Itoa(t.Day()),
+		"{month}", l.months[t.Month()-1],
+		"{year}", strconv.Itoa(t.Year()),
+	).Replace(l.dateFormatPattern)
+}
+
+// Number formats an integer with the locale's digit grouping.
+func (l *Locale) Number(n int) string {
+	return l.group(strconv.Itoa(n))
+}
+
+// Decimal formats a number with the given digits after the decimal separator.
+func (l *Locale) Decimal(f float64, precision int) string {
+	s := strconv.FormatFloat(f, 'f', precision, 64)
+
+	whole, fraction, ok := strings.Cut(s, ".")
+	whole = l.group(whole)
+	if !ok {
+		return whole
+	}
+
+	return whole + l.decimalSeparator + fraction
+}
+
+func (l *Locale) group(digits string) string {
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+
+	// Four-digit numbers are conventionally left ungrouped.
+	if len(digits) <= 4 {
+		return sign + digits
+	}
+
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(l.groupSeparator)
+		}
+		b.WriteRune(d)
+	}
+
+	return sign + b.String()
+}
+
+// Temperature formats a Celsius temperature in the units of a subscription.
+func (l *Locale) Temperature(celsius int, units string) string {
+	if units == models.UnitsImperial {
+		fahrenheit := int(math.Round(float64(celsius)*9/5 + 32))
+		return l.Number(fahrenheit) + l.unitSeparator + "°F"
+	}
+
+	return l.Number(celsius) + l.unitSeparator + "°C"
+}
+
+// Frequency translates a subscription frequency as an adjective.
+func (l *Locale) Frequency(frequency string) string {
+	if translated, ok := l.frequencies[frequency]; ok {
+		return translated
+	}
+
+	return frequency
+}
+
+// Condition translates the weather condition text reported by the weather
+// provider. Unknown conditions are returned unchanged.
+func (l *Locale) Condition(condition string) string {
+	key := strings.ToLower(strings.TrimSpace(condition))
+	if translated, ok := l.conditions[key]; ok {
+		return translated
+	}
+
+	return condition
+}
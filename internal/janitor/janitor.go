@@ -0,0 +1,181 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+	"weather/internal/config"
+	"weather/internal/mailer"
+	"weather/internal/models"
+	"weather/internal/srverrors"
+	"weather/internal/token"
+)
+
+const (
+	RunTimeout             = 30 * time.Second
+	ReminderBatchSize      = 100
+	defaultJanitorInterval = 10 * time.Minute
+)
+
+type SubscriptionStore interface {
+	PurgeExpired(ctx context.Context) (int64, error)
+	GetUnreminded(ctx context.Context, within time.Duration, limit int) ([]models.Subscription, error)
+	MarkReminded(ctx context.Context, sub models.Subscription, reminder models.OutboxMessage) error
+}
+
+type OutboxStore interface {
+	PurgeSent(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+type SessionStore interface {
+	PurgeStale(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+type ReminderBuilder interface {
+	BuildReminderEmail(sub models.Subscription) (mailer.Email, error)
+}
+
+type EmailQueue interface {
+	Message(email mailer.Email) models.OutboxMessage
+}
+
+// Janitor periodically purges pending subscriptions whose confirmation
+// window has passed and, if enabled, reminds about the ones about to expire
+// and purges old sent outbox messages. It also drops session rows no live
+// session depends on.
+type Janitor struct {
+	store            SubscriptionStore
+	outbox           OutboxStore
+	sessions         SessionStore
+	builder          ReminderBuilder
+	queue            EmailQueue
+	config           config.SubscriptionConfig
+	sentRetention    time.Duration
+	sessionRetention time.Duration
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func New(
+	store SubscriptionStore,
+	outbox OutboxStore,
+	sessions SessionStore,
+	builder ReminderBuilder,
+	queue EmailQueue,
+	config config.SubscriptionConfig,
+	sentRetention time.Duration,
+	sessionRetention time.Duration,
+) *Janitor {
+	if config.JanitorInterval <= 0 {
+		config.JanitorInterval = defaultJanitorInterval
+	}
+
+	return &Janitor{
+		store:            store,
+		outbox:           outbox,
+		sessions:         sessions,
+		builder:          builder,
+		queue:            queue,
+		config:           config,
+		sentRetention:    sentRetention,
+		sessionRetention: sessionRetention,
+	}
+}
+
+func (j *Janitor) Start() {
+	j.stopChan = make(chan struct{})
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+
+		ticker := time.NewTicker(j.config.JanitorInterval)
+		defer ticker.Stop()
+
+		for {
+			j.run()
+
+			select {
+			case <-ticker.C:
+			case <-j.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (j *Janitor) Stop() {
+	close(j.stopChan)
+	j.wg.Wait()
+}
+
+func (j *Janitor) run() {
+	ctx, cancel := context.WithTimeout(context.Background(), RunTimeout)
+	defer cancel()
+
+	if j.config.ReminderBefore > 0 {
+		j.remind(ctx)
+	}
+
+	if j.sentRetention > 0 {
+		j.purgeSent(ctx)
+	}
+
+	if purged, err := j.sessions.PurgeStale(ctx, j.sessionRetention); err != nil {
+		log.Printf("janitor session purge error: %v\n", err)
+	} else if purged > 0 {
+		log.Printf("janitor purged %d stale sessions\n", purged)
+	}
+
+	purged, err := j.store.PurgeExpired(ctx)
+	if err != nil {
+		log.Printf("janitor purge error: %v\n", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("janitor purged %d expired pending subscriptions\n", purged)
+	}
+}
+
+func (j *Janitor) purgeSent(ctx context.Context) {
+	purged, err := j.outbox.PurgeSent(ctx, j.sentRetention)
+	if err != nil {
+		log.Printf("janitor outbox purge error: %v\n", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("janitor purged %d sent outbox messages\n", purged)
+	}
+}
+
+// remind sends the reminders with a fresh confirmation token, as only
+// hashes of the tokens sent before are stored.
+func (j *Janitor) remind(ctx context.Context) {
+	subs, err := j.store.GetUnreminded(ctx, j.config.ReminderBefore, ReminderBatchSize)
+	if err != nil {
+		log.Printf("janitor reminder lookup error: %v\n", err)
+		return
+	}
+
+	for _, sub := range subs {
+		sub.ConfirmToken, err = token.Generate()
+		if err != nil {
+			log.Printf("janitor reminder error: %v\n", err)
+			return
+		}
+
+		reminder, err := j.builder.BuildReminderEmail(sub)
+		if err != nil {
+			log.Printf("janitor reminder render error for subscription %d: %v\n", sub.ID, err)
+			continue
+		}
+
+		err = j.store.MarkReminded(ctx, sub, j.queue.Message(reminder))
+		if err != nil && !errors.Is(err, srverrors.ErrorNotFound) {
+			log.Printf("janitor reminder error for subscription %d: %v\n", sub.ID, err)
+		}
+	}
+}
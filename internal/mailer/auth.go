@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"net/smtp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthNone    = "none"
+)
+
+var ErrUnknownAuth = errors.New("unknown SMTP auth mechanism")
+
+func newAuth(mechanism, user, password, host string) (smtp.Auth, error) {
+	switch strings.ToLower(mechanism) {
+	case AuthPlain, "":
+		return smtp.PlainAuth("", user, password, host), nil
+	case AuthLogin:
+		return &loginAuth{username: user, password: password, host: host}, nil
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(user, password), nil
+	case AuthNone:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(ErrUnknownAuth, mechanism)
+	}
+}
+
+// loginAuth implements the non-standard but widespread AUTH LOGIN mechanism.
+// Like smtp.PlainAuth it refuses to send credentials over an unencrypted
+// connection to anything but localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, errors.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
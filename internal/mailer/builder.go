@@ -1,37 +1,151 @@
 package mailer
 
 import (
-	"context"
-	"fmt"
+	"net/url"
+	"strings"
 	"time"
 	"weather/internal/models"
 )
 
+type forecastData struct {
+	Email          string
+	City           string
+	Frequency      string
+	Units          string
+	Date           time.Time
+	Weather        models.Weather
+	UnsubscribeURL string
+}
+
+type subscriptionData struct {
+	Email     string
+	City      string
+	Frequency string
+}
+
+type confirmationData struct {
+	subscriptionData
+	ConfirmURL string
+	CancelURL  string
+	ExpiresAt  time.Time
+}
+
+type manageData struct {
+	Email        string
+	LoginURL     string
+	ValidMinutes int
+}
+
+type alertData struct {
+	Email   string
+	City    string
+	Alert   string
+	Weather models.Weather
+}
+
 type EmailBuilder struct {
-	subject string
-	body    string
+	renderer      *Renderer
+	publicBaseURL string
 }
 
-func NewEmailBuilder() *EmailBuilder {
+func NewEmailBuilder(renderer *Renderer, publicBaseURL string) *EmailBuilder {
 	return &EmailBuilder{
-		subject: " for %s – %s",
-		body: "Hello %s,\n\nCurrent weather in %s:\n" +
-			"- %s\n- Temperature: %d°C\n- Humidity: %d%%\n",
+		renderer:      renderer,
+		publicBaseURL: strings.TrimRight(publicBaseURL, "/"),
+	}
+}
+
+func (e *EmailBuilder) link(path, token string) string {
+	return e.publicBaseURL + path + url.PathEscape(token)
+}
+
+func (e *EmailBuilder) build(to, name, language string, data any) (Email, error) {
+	subject, text, html, err := e.renderer.Render(name, language, data)
+	if err != nil {
+		return Email{}, err
+	}
+
+	return Email{
+		To:      to,
+		Subject: subject,
+		Body:    text,
+		HTML:    html,
+	}, nil
+}
+
+// BuildWeatherForecastEmail includes an unsubscribe link and the RFC 8058
+// one-click unsubscribe headers.
+func (e *EmailBuilder) BuildWeatherForecastEmail(forecast models.Forecast, frequency string) (Email, error) {
+	unsubscribeURL := e.link("/api/unsubscribe/", forecast.UnsubscribeToken)
+
+	email, err := e.build(forecast.Email, TemplateForecast, forecast.Language, forecastData{
+		Email:          forecast.Email,
+		City:           forecast.City,
+		Frequency:      frequency,
+		Units:          forecast.Units,
+		Date:           time.Now(),
+		Weather:        forecast.Weather,
+		UnsubscribeURL: unsubscribeURL,
+	})
+	if err != nil {
+		return Email{}, err
+	}
+
+	email.Headers = map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
 	}
+
+	return email, nil
+}
+
+// BuildConfirmationEmail links to confirming the subscription and to
+// cancelling it for people who never subscribed.
+func (e *EmailBuilder) BuildConfirmationEmail(sub models.Subscription) (Email, error) {
+	return e.build(sub.Email, TemplateConfirmation, sub.Language, e.confirmationData(sub))
+}
+
+// BuildReminderEmail reminds about a pending subscription shortly before
+// its confirmation link expires.
+func (e *EmailBuilder) BuildReminderEmail(sub models.Subscription) (Email, error) {
+	return e.build(sub.Email, TemplateReminder, sub.Language, e.confirmationData(sub))
+}
+
+func (e *EmailBuilder) confirmationData(sub models.Subscription) confirmationData {
+	return confirmationData{
+		subscriptionData: subscriptionData{
+			Email:     sub.Email,
+			City:      sub.City,
+			Frequency: sub.Frequency,
+		},
+		ConfirmURL: e.link("/api/confirm/", sub.ConfirmToken),
+		CancelURL:  e.link("/api/cancel/", sub.ConfirmToken),
+		ExpiresAt:  sub.ConfirmationExpiresAt,
+	}
+}
+
+func (e *EmailBuilder) BuildUnsubscribeEmail(sub models.Subscription) (Email, error) {
+	return e.build(sub.Email, TemplateUnsubscribe, sub.Language, subscriptionData{
+		Email:     sub.Email,
+		City:      sub.City,
+		Frequency: sub.Frequency,
+	})
+}
+
+// BuildManageEmail links to a session managing every subscription of the email.
+func (e *EmailBuilder) BuildManageEmail(to, language, loginToken string, validFor time.Duration) (Email, error) {
+	return e.build(to, TemplateManage, language, manageData{
+		Email:        to,
+		LoginURL:     e.link("/api/manage/login/", loginToken),
+		ValidMinutes: int(validFor.Minutes()),
+	})
 }
 
-func (e *EmailBuilder) BuildWeatherForecastEmail(ctx context.Context,
-	email string,
-	city string,
-	weatherData models.Weather,
-) (string, string) {
-	subject := fmt.Sprintf(e.subject, city, time.Now().Format("2006-01-02"))
-	body := fmt.Sprintf(e.body,
-		email, city,
-		weatherData.Description,
-		weatherData.Temperature,
-		weatherData.Humidity,
-	)
-
-	return subject, body
+func (e *EmailBuilder) BuildAlertEmail(to, city, language, alert string, weather models.Weather) (Email, error) {
+	return e.build(to, TemplateAlert, language, alertData{
+		Email:   to,
+		City:    city,
+		Alert:   alert,
+		Weather: weather,
+	})
 }
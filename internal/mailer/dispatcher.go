@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weather/internal/config"
+
+	"github.com/pkg/errors"
+)
+
+const SendTimeout = 30 * time.Second
+
+var ErrDispatcherStopped = errors.New("dispatcher is stopped")
+
+type job struct {
+	email  Email
+	batch  *Batch
+	report func(error)
+}
+
+// Batch tracks the completion of a group of submitted emails.
+type Batch struct {
+	wg     sync.WaitGroup
+	sent   atomic.Int64
+	failed atomic.Int64
+}
+
+type BatchResult struct {
+	Sent   int
+	Failed int
+}
+
+// Wait blocks until every email submitted with the batch has been handled.
+func (b *Batch) Wait() BatchResult {
+	b.wg.Wait()
+
+	return BatchResult{
+		Sent:   int(b.sent.Load()),
+		Failed: int(b.failed.Load()),
+	}
+}
+
+// Dispatcher sends emails with a fixed number of workers reading
+// from a bounded queue; Submit blocks while the queue is full.
+type Dispatcher struct {
+	transport Transport
+	queue     chan job
+	wg        sync.WaitGroup
+
+	mx      sync.RWMutex
+	stopped bool
+}
+
+func NewDispatcher(transport Transport, config config.MailerConfig) *Dispatcher {
+	workers := max(config.Workers, 1)
+	queueSize := max(config.QueueSize, 0)
+
+	d := &Dispatcher{
+		transport: transport,
+		queue:     make(chan job, queueSize),
+	}
+
+	d.wg.Add(workers)
+	for range workers {
+		go d.work()
+	}
+
+	return d
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for j := range d.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), SendTimeout)
+		err := d.transport.Send(ctx, j.email)
+		cancel()
+		if err != nil {
+			log.Printf("email error to %s: %v\n", j.email.To, err)
+			j.batch.failed.Add(1)
+		} else {
+			j.batch.sent.Add(1)
+		}
+		if j.report != nil {
+			j.report(err)
+		}
+		j.batch.wg.Done()
+	}
+}
+
+func (d *Dispatcher) NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Submit enqueues the email as part of the batch, waiting for free space
+// in the queue until the context is done. The optional report is called
+// with the outcome once the email has been handled.
+func (d *Dispatcher) Submit(ctx context.Context, batch *Batch, email Email, report func(error)) error {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	if d.stopped {
+		return ErrDispatcherStopped
+	}
+
+	batch.wg.Add(1)
+	select {
+	case d.queue <- job{email: email, batch: batch, report: report}:
+		return nil
+	case <-ctx.Done():
+		batch.wg.Done()
+		return errors.Wrap(ctx.Err(), "email queue is full")
+	}
+}
+
+// Stop rejects new emails and waits until the queued ones are sent.
+func (d *Dispatcher) Stop() {
+	d.mx.Lock()
+	if d.stopped {
+		d.mx.Unlock()
+		return
+	}
+	d.stopped = true
+	close(d.queue)
+	d.mx.Unlock()
+
+	d.wg.Wait()
+}
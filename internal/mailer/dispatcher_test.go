@@ -0,0 +1,236 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"weather/internal/config"
+)
+
+var errRejected = errors.New("rejected")
+
+// fakeTransport records sends and how many run at once. With release set,
+// every send waits until it is closed.
+type fakeTransport struct {
+	release chan struct{}
+
+	mx          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	sent        []string
+}
+
+func (f *fakeTransport) Send(ctx context.Context, email Email) error {
+	f.mx.Lock()
+	f.inFlight++
+	f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	f.mx.Unlock()
+
+	defer func() {
+		f.mx.Lock()
+		f.inFlight--
+		f.mx.Unlock()
+	}()
+
+	if f.release != nil {
+		<-f.release
+	}
+	if strings.HasPrefix(email.To, "fail") {
+		return errRejected
+	}
+
+	f.mx.Lock()
+	f.sent = append(f.sent, email.To)
+	f.mx.Unlock()
+
+	return nil
+}
+
+func (f *fakeTransport) Close() error {
+	return nil
+}
+
+func (f *fakeTransport) stats() (inFlight, maxInFlight, sent int) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	return f.inFlight, f.maxInFlight, len(f.sent)
+}
+
+func TestDispatcherConcurrency(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		want    int
+	}{
+		{name: "one worker", workers: 1, want: 1},
+		{name: "three workers", workers: 3, want: 3},
+		{name: "no workers configured", workers: 0, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &fakeTransport{release: make(chan struct{})}
+			d := NewDispatcher(transport, config.MailerConfig{Workers: tt.workers, QueueSize: 20})
+			defer d.Stop()
+
+			batch := d.NewBatch()
+			for i := range 10 {
+				if err := d.Submit(context.Background(), batch, Email{To: fmt.Sprintf("user%d@example.com", i)}, nil); err != nil {
+					t.Fatalf("Submit: %v", err)
+				}
+			}
+
+			waitFor(t, func() bool {
+				inFlight, _, _ := transport.stats()
+				return inFlight == tt.want
+			})
+			// Give extra workers, if any, the chance to exceed the bound.
+			time.Sleep(20 * time.Millisecond)
+			close(transport.release)
+
+			if result := batch.Wait(); result != (BatchResult{Sent: 10}) {
+				t.Errorf("batch result = %+v, want 10 sent", result)
+			}
+			if _, maxInFlight, _ := transport.stats(); maxInFlight != tt.want {
+				t.Errorf("max sends in flight = %d, want %d", maxInFlight, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherBatches(t *testing.T) {
+	transport := &fakeTransport{}
+	d := NewDispatcher(transport, config.MailerConfig{Workers: 4, QueueSize: 2})
+	defer d.Stop()
+
+	tests := []struct {
+		name       string
+		recipients []string
+		want       BatchResult
+	}{
+		{name: "all sent", recipients: []string{"a@example.com", "b@example.com", "c@example.com"}, want: BatchResult{Sent: 3}},
+		{name: "some failed", recipients: []string{"d@example.com", "fail1@example.com", "fail2@example.com"}, want: BatchResult{Sent: 1, Failed: 2}},
+		{name: "all failed", recipients: []string{"fail3@example.com"}, want: BatchResult{Failed: 1}},
+		{name: "empty", want: BatchResult{}},
+	}
+
+	// The batches are submitted together, so their emails interleave in the queue.
+	type submitted struct {
+		batch   *Batch
+		mx      sync.Mutex
+		reports map[string]error
+	}
+	batches := make([]*submitted, len(tests))
+	for i, tt := range tests {
+		s := &submitted{batch: d.NewBatch(), reports: make(map[string]error)}
+		batches[i] = s
+		for _, to := range tt.recipients {
+			report := func(err error) {
+				s.mx.Lock()
+				s.reports[to] = err
+				s.mx.Unlock()
+			}
+			if err := d.Submit(context.Background(), s.batch, Email{To: to}, report); err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+		}
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := batches[i]
+			if result := s.batch.Wait(); result != tt.want {
+				t.Errorf("batch result = %+v, want %+v", result, tt.want)
+			}
+
+			s.mx.Lock()
+			defer s.mx.Unlock()
+			if len(s.reports) != len(tt.recipients) {
+				t.Errorf("%d reports, want %d", len(s.reports), len(tt.recipients))
+			}
+			for to, err := range s.reports {
+				if wantErr := strings.HasPrefix(to, "fail"); (err != nil) != wantErr {
+					t.Errorf("report for %s = %v, want error %t", to, err, wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcherSubmitFullQueue(t *testing.T) {
+	transport := &fakeTransport{release: make(chan struct{})}
+	d := NewDispatcher(transport, config.MailerConfig{Workers: 1, QueueSize: 1})
+	defer d.Stop()
+	defer close(transport.release)
+
+	batch := d.NewBatch()
+	// One email is being sent and one waits in the queue.
+	for i := range 2 {
+		if err := d.Submit(context.Background(), batch, Email{To: fmt.Sprintf("user%d@example.com", i)}, nil); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+		if i == 0 {
+			waitFor(t, func() bool {
+				inFlight, _, _ := transport.stats()
+				return inFlight == 1
+			})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := d.Submit(ctx, batch, Email{To: "late@example.com"}, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Submit to a full queue error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDispatcherStop(t *testing.T) {
+	transport := &fakeTransport{release: make(chan struct{})}
+	d := NewDispatcher(transport, config.MailerConfig{Workers: 2, QueueSize: 10})
+
+	batch := d.NewBatch()
+	for i := range 5 {
+		if err := d.Submit(context.Background(), batch, Email{To: fmt.Sprintf("user%d@example.com", i)}, nil); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	waitFor(t, func() bool {
+		inFlight, _, _ := transport.stats()
+		return inFlight == 2
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		d.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned while sends were in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(transport.release)
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Stop didn't return after the sends finished")
+	}
+
+	if _, _, sent := transport.stats(); sent != 5 {
+		t.Errorf("%d emails sent before Stop returned, want the 5 queued", sent)
+	}
+	if err := d.Submit(context.Background(), d.NewBatch(), Email{To: "late@example.com"}, nil); !errors.Is(err, ErrDispatcherStopped) {
+		t.Errorf("Submit after Stop error = %v, want %v", err, ErrDispatcherStopped)
+	}
+
+	// Stopping again is a no-op.
+	d.Stop()
+}
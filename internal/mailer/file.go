@@ -0,0 +1,156 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	joinErr "errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"weather/internal/config"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FileFormatMaildir = "maildir"
+	FileFormatMbox    = "mbox"
+)
+
+var ErrUnknownFileFormat = errors.New("unknown mail file format")
+
+// FileTransport writes emails into a maildir directory or appends them to an mbox file.
+type FileTransport struct {
+	format string
+	path   string
+	from   mail.Address
+	mx     sync.Mutex
+}
+
+func NewFileTransport(config config.FileTransportConfig, from mail.Address) (*FileTransport, error) {
+	if config.Path == "" {
+		return nil, errors.New("file mail transport requires a path")
+	}
+
+	format := strings.ToLower(config.Format)
+	if format == "" {
+		format = FileFormatMaildir
+	}
+
+	switch format {
+	case FileFormatMaildir:
+		for _, dir := range []string{"tmp", "new", "cur"} {
+			if err := os.MkdirAll(filepath.Join(config.Path, dir), 0o750); err != nil {
+				return nil, errors.Wrap(err, "unable to create maildir")
+			}
+		}
+	case FileFormatMbox:
+		if err := os.MkdirAll(filepath.Dir(config.Path), 0o750); err != nil {
+			return nil, errors.Wrap(err, "unable to create mbox directory")
+		}
+	default:
+		return nil, errors.Wrap(ErrUnknownFileFormat, config.Format)
+	}
+
+	return &FileTransport{
+		format: format,
+		path:   config.Path,
+		from:   from,
+	}, nil
+}
+
+func (t *FileTransport) Send(_ context.Context, email Email) error {
+	msg, err := composeMessage(t.from, email)
+	if err != nil {
+		return err
+	}
+
+	if t.format == FileFormatMbox {
+		return t.appendMbox(msg)
+	}
+
+	return t.deliverMaildir(msg)
+}
+
+func uniqueName() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "unable to generate file name")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), hex.EncodeToString(buf), hostname), nil
+}
+
+// deliverMaildir writes the message into tmp/ and moves it into new/,
+// so readers never observe a partially written message.
+func (t *FileTransport) deliverMaildir(msg []byte) error {
+	name, err := uniqueName()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(t.path, "tmp", name)
+	if err := os.WriteFile(tmpPath, msg, 0o600); err != nil {
+		return errors.Wrap(err, "unable to write maildir message")
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(t.path, "new", name)); err != nil {
+		return errors.Wrap(err, "unable to deliver maildir message")
+	}
+
+	return nil
+}
+
+func (t *FileTransport) appendMbox(msg []byte) (err error) {
+	var entry bytes.Buffer
+	entry.WriteString(fmt.Sprintf("From %s %s\n", t.from.Address, time.Now().UTC().Format(time.ANSIC)))
+	for _, line := range strings.Split(strings.ReplaceAll(string(msg), "\r\n", "\n"), "\n") {
+		// mboxrd quoting of lines that could be mistaken for a message separator.
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			entry.WriteString(">")
+		}
+		entry.WriteString(line + "\n")
+	}
+	entry.WriteString("\n")
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	file, err := os.OpenFile(t.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "unable to open mbox")
+	}
+
+	defer func() {
+		closeErr := file.Close()
+		if closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "failed to close mbox")
+			if err != nil {
+				err = joinErr.Join(err, closeErr)
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	if _, err := file.Write(entry.Bytes()); err != nil {
+		return errors.Wrap(err, "unable to append to mbox")
+	}
+
+	return nil
+}
+
+func (t *FileTransport) Close() error {
+	return nil
+}
@@ -3,19 +3,25 @@ package mailer
 import (
 	"context"
 	"log"
+	"sync"
 	"weather/internal/models"
+	"weather/internal/token"
 	"weather/internal/weather"
-
-	"golang.org/x/exp/slices"
 )
 
+const MaxConcurrentCityFetches = 8
+
+type fetchFunc func(ctx context.Context, city string) (models.Weather, error)
+
 type Forecaster struct {
 	weather *weather.RemoteService
+	signer  *token.Signer
 }
 
-func NewForecaster(weather *weather.RemoteService) *Forecaster {
+func NewForecaster(weather *weather.RemoteService, signer *token.Signer) *Forecaster {
 	return &Forecaster{
 		weather: weather,
+		signer:  signer,
 	}
 }
 
@@ -23,22 +29,80 @@ func (f *Forecaster) GetForecasts(
 	ctx context.Context,
 	subscriptions []models.Subscription,
 ) []models.Forecast {
-	forecasts := make([]models.Forecast, len(subscriptions))
-	for idx, sub := range subscriptions {
-		weatherData, err := f.weather.GetCityWeather(ctx, sub.City)
-		if err != nil {
-			log.Printf("weather fetch error for %q: %v\n", sub.City, err)
+	weathers := fetchCities(ctx, subscriptions, f.weather.GetCityWeather)
+
+	forecasts := make([]models.Forecast, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		weatherData, ok := weathers[weather.NormalizeCity(sub.City)]
+		if !ok {
 			continue
 		}
 
-		forecasts[idx] = models.Forecast{
-			Email:   sub.Email,
-			Weather: weatherData,
+		forecasts = append(forecasts, models.Forecast{
+			Email:            sub.Email,
+			City:             sub.City,
+			Language:         sub.Language,
+			Units:            sub.Units,
+			UnsubscribeToken: f.signer.Unsubscribe(sub.UnsubscribeSalt),
+			Weather:          weatherData,
+		})
+	}
+
+	return forecasts
+}
+
+// Prefetch refreshes the cached weather for every distinct subscribed city,
+// so that the following GetForecasts call is served from the cache.
+func (f *Forecaster) Prefetch(ctx context.Context, subscriptions []models.Subscription) {
+	fetchCities(ctx, subscriptions, f.weather.Refresh)
+}
+
+// fetchCities calls fetch once per distinct normalized city with at most
+// MaxConcurrentCityFetches calls in flight. Cities that failed are logged
+// once and are absent from the result.
+func fetchCities(
+	ctx context.Context,
+	subscriptions []models.Subscription,
+	fetch fetchFunc,
+) map[string]models.Weather {
+	cities := make(map[string]string)
+	affected := make(map[string]int)
+	for _, sub := range subscriptions {
+		key := weather.NormalizeCity(sub.City)
+		if _, ok := cities[key]; !ok {
+			cities[key] = sub.City
 		}
+		affected[key]++
 	}
 
-	filter := func(f models.Forecast) bool { return f.Email == "" }
-	forecasts = slices.DeleteFunc(forecasts, filter)
+	var (
+		mx       sync.Mutex
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, MaxConcurrentCityFetches)
+		weathers = make(map[string]models.Weather, len(cities))
+	)
 
-	return forecasts
+	for key, city := range cities {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(key, city string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			weatherData, err := fetch(ctx, city)
+			if err != nil {
+				log.Printf("weather fetch error for %q (%d subscriptions): %v\n", city, affected[key], err)
+				return
+			}
+
+			mx.Lock()
+			weathers[key] = weatherData
+			mx.Unlock()
+		}(key, city)
+	}
+
+	wg.Wait()
+
+	return weathers
 }
@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	joinErr "errors"
+	"io"
+	"net/http"
+	"net/mail"
+	"weather/internal/config"
+
+	"github.com/pkg/errors"
+)
+
+const maxHTTPErrorBody = 1024
+
+// HTTPTransport sends emails through a SendGrid/Mailgun-style JSON API.
+type HTTPTransport struct {
+	endpoint string
+	apiKey   string
+	from     mail.Address
+	client   *http.Client
+}
+
+type httpEmailRequest struct {
+	From    string            `json:"from"`
+	To      []string          `json:"to"`
+	Subject string            `json:"subject"`
+	Text    string            `json:"text"`
+	HTML    string            `json:"html,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func NewHTTPTransport(config config.HTTPTransportConfig, from mail.Address) (*HTTPTransport, error) {
+	if config.URL == "" {
+		return nil, errors.New("HTTP mail transport requires an endpoint URL")
+	}
+
+	return &HTTPTransport{
+		endpoint: config.URL,
+		apiKey:   config.APIKey,
+		from:     from,
+		client:   &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+func (t *HTTPTransport) Send(ctx context.Context, email Email) (err error) {
+	payload, err := json.Marshal(httpEmailRequest{
+		From:    t.from.String(),
+		To:      []string{email.To},
+		Subject: email.Subject,
+		Text:    email.Body,
+		HTML:    email.HTML,
+		Headers: email.Headers,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal email")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "unable to create request to mail API")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "unable to send request to mail API")
+	}
+
+	defer func() {
+		closeErr := resp.Body.Close()
+		if closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "failed to close response body")
+			if err != nil {
+				err = joinErr.Join(err, closeErr)
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHTTPErrorBody))
+		err := errors.Errorf("mail API responded %d: %s", resp.StatusCode, body)
+		if resp.StatusCode < http.StatusInternalServerError && resp.StatusCode != http.StatusTooManyRequests {
+			return &PermanentError{Err: err}
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (t *HTTPTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,107 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"reflect"
+	"testing"
+	"time"
+	"weather/internal/config"
+)
+
+func TestHTTPTransportSend(t *testing.T) {
+	email := Email{
+		To:      "user@example.com",
+		Subject: "Weather in Kyiv",
+		Body:    "Sunny",
+		HTML:    "<p>Sunny</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://example.com/u>"},
+	}
+
+	tests := []struct {
+		name          string
+		status        int
+		wantErr       bool
+		wantPermanent bool
+	}{
+		{name: "accepted", status: http.StatusAccepted},
+		{name: "rejected", status: http.StatusBadRequest, wantErr: true, wantPermanent: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantErr: true},
+		{name: "server error", status: http.StatusBadGateway, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				got  httpEmailRequest
+				auth string
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth = r.Header.Get("Authorization")
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("decode request: %v", err)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			transport, err := NewHTTPTransport(
+				config.HTTPTransportConfig{URL: server.URL, APIKey: "secret", Timeout: time.Second},
+				mail.Address{Name: "Weather", Address: "noreply@example.com"},
+			)
+			if err != nil {
+				t.Fatalf("NewHTTPTransport: %v", err)
+			}
+			defer transport.Close()
+
+			err = transport.Send(context.Background(), email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send error = %v, want error %t", err, tt.wantErr)
+			}
+			if IsPermanent(err) != tt.wantPermanent {
+				t.Errorf("IsPermanent(%v) = %t, want %t", err, IsPermanent(err), tt.wantPermanent)
+			}
+
+			if auth != "Bearer secret" {
+				t.Errorf("Authorization = %q, want %q", auth, "Bearer secret")
+			}
+			want := httpEmailRequest{
+				From:    `"Weather" <noreply@example.com>`,
+				To:      []string{email.To},
+				Subject: email.Subject,
+				Text:    email.Body,
+				HTML:    email.HTML,
+				Headers: email.Headers,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("request = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestHTTPTransportSendCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	transport, err := NewHTTPTransport(config.HTTPTransportConfig{URL: server.URL}, mail.Address{Address: "noreply@example.com"})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport: %v", err)
+	}
+	defer transport.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = transport.Send(ctx, Email{To: "user@example.com"})
+	if err == nil || IsPermanent(err) {
+		t.Fatalf("Send error = %v, want a temporary error", err)
+	}
+}
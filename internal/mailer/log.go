@@ -0,0 +1,26 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"net/mail"
+)
+
+// LogTransport is a dry run: it only logs what would have been sent.
+type LogTransport struct {
+	from mail.Address
+}
+
+func NewLogTransport(from mail.Address) *LogTransport {
+	return &LogTransport{from: from}
+}
+
+func (t *LogTransport) Send(_ context.Context, email Email) error {
+	log.Printf("dry-run email from=%q to=%q subject=%q body_bytes=%d\n",
+		t.from.String(), email.To, email.Subject, len(email.Body))
+	return nil
+}
+
+func (t *LogTransport) Close() error {
+	return nil
+}
@@ -2,11 +2,13 @@ package mailer
 
 import (
 	"context"
+	"log"
 	"sync"
 	"time"
 
 	"weather/internal/config"
 	"weather/internal/models"
+	"weather/internal/token"
 	"weather/internal/weather"
 )
 
@@ -15,6 +17,7 @@ const (
 	SendEmailDailyTimeout  = time.Minute * 15
 	SendEmailHourlyTimeout = time.Minute * 15
 	LoadTimeoutDuration    = time.Second * 5
+	PrewarmLead            = time.Minute * 5
 )
 
 type MailerStore interface {
@@ -22,24 +25,62 @@ type MailerStore interface {
 }
 
 type Manager struct {
-	Mailer    *SMTPMailer
-	Targets   *TargetManager
-	Forecasts *Forecaster
+	Mailer     Transport
+	Targets    *TargetManager
+	Forecasts  *Forecaster
+	Dispatcher *Dispatcher
+	Outbox     *OutboxRelay
+	Builder    *EmailBuilder
 
 	stopChan chan struct{}
 	wg       sync.WaitGroup
 	running  bool
+
+	// Daily and hourly mailings start at the same moment; their pre-warms
+	// share the cities refreshed for it.
+	prewarmMx   sync.Mutex
+	prewarmedAt time.Time
+	prewarmed   map[string]bool
+}
+
+// schedule describes one periodic mailing. Without due every target
+// of the frequency receives each mailing.
+type schedule struct {
+	frequency string
+	timeout   time.Duration
+	next      func(now time.Time) time.Time
+	due       func(sub models.Subscription, at time.Time) bool
+}
+
+// dueAtDeliveryHour picks the daily subscriptions delivered at the hour.
+func dueAtDeliveryHour(sub models.Subscription, at time.Time) bool {
+	return sub.DeliveryHour == at.Hour()
+}
+
+func nextHour(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, now.Location())
 }
 
-func New(config config.SMTPConfig, weatherService *weather.RemoteService) *Manager {
-	forecaster := NewForecaster(weatherService)
-	mailer := NewSMTPMailer(config, NewEmailBuilder())
+func New(
+	transport Transport,
+	builder *EmailBuilder,
+	mailerConfig config.MailerConfig,
+	outboxConfig config.OutboxConfig,
+	outboxStore OutboxStore,
+	weatherService *weather.RemoteService,
+	signer *token.Signer,
+) *Manager {
+	forecaster := NewForecaster(weatherService, signer)
+	dispatcher := NewDispatcher(transport, mailerConfig)
 
 	return &Manager{
-		Mailer:    mailer,
-		Targets:   &TargetManager{},
-		Forecasts: forecaster,
-		stopChan:  make(chan struct{}),
+		Mailer:     transport,
+		Targets:    &TargetManager{},
+		Forecasts:  forecaster,
+		Dispatcher: dispatcher,
+		Outbox:     NewOutboxRelay(outboxStore, dispatcher, outboxConfig),
+		Builder:    builder,
+		stopChan:   make(chan struct{}),
 	}
 }
 
@@ -51,81 +92,186 @@ func (m *Manager) AddTarget(sub models.Subscription) {
 	m.Targets.AddTarget(sub)
 }
 
-func (m *Manager) RemoveTarget(email string, frequency string) {
-	m.Targets.RemoveTarget(email, frequency)
+func (m *Manager) RemoveTarget(id int64) {
+	m.Targets.RemoveTarget(id)
 }
 
 func (m *Manager) Start() {
 	m.running = true
 	m.stopChan = make(chan struct{})
 
-	// Daily
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		now := time.Now()
-		nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-		select {
-		case <-time.After(nextMidnight.Sub(now)):
-		case <-m.stopChan:
+	m.Outbox.Start()
+
+	schedules := []schedule{
+		{
+			frequency: models.Daily,
+			timeout:   SendEmailDailyTimeout,
+			next:      nextHour,
+			due:       dueAtDeliveryHour,
+		},
+		{
+			frequency: models.Hourly,
+			timeout:   SendEmailHourlyTimeout,
+			next:      nextHour,
+		},
+	}
+
+	for _, s := range schedules {
+		m.wg.Add(1)
+		go func(s schedule) {
+			defer m.wg.Done()
+			m.run(s)
+		}(s)
+	}
+}
+
+// run pre-warms the weather cache PrewarmLead before every scheduled
+// mailing, so that the mailing itself doesn't wait for the weather API.
+func (m *Manager) run(s schedule) {
+	for {
+		at := s.next(time.Now())
+
+		if !m.waitUntil(at.Add(-PrewarmLead)) {
 			return
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), SendEmailDailyTimeout)
-		targets := m.Targets.GetTargets(models.Daily)
-		forecasts := m.Forecasts.GetForecasts(ctx, targets)
-		m.Mailer.sendEmails(ctx, forecasts, "Daily Weather")
-		cancel()
-		ticker := time.NewTicker(Day)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				ctx, cancel := context.WithTimeout(context.Background(), SendEmailDailyTimeout)
-				targets := m.Targets.GetTargets(models.Daily)
-				forecasts := m.Forecasts.GetForecasts(ctx, targets)
-				m.Mailer.sendEmails(ctx, forecasts, "Daily Weather")
-				cancel()
-			case <-m.stopChan:
-				return
-			}
-		}
-	}()
-
-	// Hourly
-	m.wg.Add(1)
-	go func() {
-		defer m.wg.Done()
-		now := time.Now()
-		nextHour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, now.Location())
-		select {
-		case <-time.After(nextHour.Sub(now)):
-		case <-m.stopChan:
+		m.prewarm(s, at)
+
+		if !m.waitUntil(at) {
 			return
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), SendEmailHourlyTimeout)
-		targets := m.Targets.GetTargets(models.Hourly)
-		forecasts := m.Forecasts.GetForecasts(ctx, targets)
-		m.Mailer.sendEmails(ctx, forecasts, "Hourly Weather")
-		cancel()
-		ticker := time.NewTicker(time.Hour)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				ctx, cancel := context.WithTimeout(context.Background(), SendEmailHourlyTimeout)
-				targets := m.Targets.GetTargets(models.Hourly)
-				forecasts := m.Forecasts.GetForecasts(ctx, targets)
-				m.Mailer.sendEmails(ctx, forecasts, "Hourly Weather")
-				cancel()
-			case <-m.stopChan:
-				return
+		m.send(s, at)
+	}
+}
+
+// waitUntil blocks until the moment or until the manager is stopped,
+// reporting whether the moment was reached.
+func (m *Manager) waitUntil(moment time.Time) bool {
+	timer := time.NewTimer(time.Until(moment))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-m.stopChan:
+		return false
+	}
+}
+
+// targets returns the subscriptions receiving the mailing at the moment.
+func (m *Manager) targets(s schedule, at time.Time) []models.Subscription {
+	targets := m.Targets.GetTargets(s.frequency)
+	if s.due == nil {
+		return targets
+	}
+
+	due := targets[:0]
+	for _, sub := range targets {
+		if s.due(sub, at) {
+			due = append(due, sub)
+		}
+	}
+
+	return due
+}
+
+func (m *Manager) prewarm(s schedule, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), PrewarmLead)
+	defer cancel()
+
+	started := time.Now()
+	targets := m.unprewarmed(m.targets(s, at), at)
+	m.Forecasts.Prefetch(ctx, targets)
+	log.Printf("prewarmed %s weather for %d cities in %s\n", s.frequency, len(targets), time.Since(started))
+}
+
+// unprewarmed drops the targets whose city another schedule already
+// refreshes for the mailing at the moment, and claims the others.
+func (m *Manager) unprewarmed(targets []models.Subscription, at time.Time) []models.Subscription {
+	m.prewarmMx.Lock()
+	defer m.prewarmMx.Unlock()
+
+	if !m.prewarmedAt.Equal(at) {
+		m.prewarmedAt = at
+		m.prewarmed = make(map[string]bool)
+	}
+
+	var claimed []models.Subscription
+	for _, sub := range targets {
+		city := weather.NormalizeCity(sub.City)
+		if m.prewarmed[city] {
+			continue
+		}
+		m.prewarmed[city] = true
+		claimed = append(claimed, sub)
+	}
+
+	return claimed
+}
+
+func (m *Manager) send(s schedule, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	started := time.Now()
+	targets := m.targets(s, at)
+
+	enqueued, forecasts, err := m.mail(ctx, s.frequency, targets)
+	if err != nil {
+		log.Printf("%s mailing: failed to enqueue %d emails: %v\n", s.frequency, enqueued, err)
+		return
+	}
+
+	log.Printf("%s mailing: %d emails enqueued, %d without forecast in %s\n",
+		s.frequency, enqueued, len(targets)-forecasts, time.Since(started))
+}
+
+// SendNow enqueues forecasts of the frequency for every target in the city,
+// or in every city when it is empty, regardless of their delivery hour.
+// It returns the number of targets and of enqueued emails.
+func (m *Manager) SendNow(ctx context.Context, frequency, city string) (targets, enqueued int, err error) {
+	subs := m.Targets.GetTargets(frequency)
+	if city != "" {
+		inCity := subs[:0]
+		for _, sub := range subs {
+			if weather.NormalizeCity(sub.City) == weather.NormalizeCity(city) {
+				inCity = append(inCity, sub)
 			}
 		}
-	}()
+		subs = inCity
+	}
+
+	enqueued, _, err = m.mail(ctx, frequency, subs)
+	return len(subs), enqueued, err
+}
+
+// mail renders the forecasts of the targets and enqueues them, returning
+// the number of emails and of targets that had a forecast.
+func (m *Manager) mail(ctx context.Context, frequency string, targets []models.Subscription) (int, int, error) {
+	forecasts := m.Forecasts.GetForecasts(ctx, targets)
+
+	emails := make([]Email, 0, len(forecasts))
+	for _, f := range forecasts {
+		email, err := m.Builder.BuildWeatherForecastEmail(f, frequency)
+		if err != nil {
+			log.Printf("email render error for %s: %v\n", f.Email, err)
+			continue
+		}
+		emails = append(emails, email)
+	}
+
+	return len(emails), len(forecasts), m.Outbox.Enqueue(ctx, emails...)
 }
 
+// Stop waits for the running mailings and for the outbox batch in flight.
+// Messages that are still pending stay in the outbox for the next start.
 func (m *Manager) Stop() {
 	m.running = false
 	close(m.stopChan)
 	m.wg.Wait()
+	m.Outbox.Stop()
+	m.Dispatcher.Stop()
+
+	if err := m.Mailer.Close(); err != nil {
+		log.Printf("failed to close mail transport: %v\n", err)
+	}
 }
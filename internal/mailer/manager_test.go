@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"slices"
+	"testing"
+	"time"
+	"weather/internal/models"
+)
+
+func TestManagerUnprewarmed(t *testing.T) {
+	at := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	subs := func(cities ...string) []models.Subscription {
+		result := make([]models.Subscription, 0, len(cities))
+		for _, city := range cities {
+			result = append(result, models.Subscription{City: city})
+		}
+		return result
+	}
+
+	m := &Manager{}
+
+	steps := []struct {
+		name    string
+		at      time.Time
+		targets []models.Subscription
+		want    []string
+	}{
+		{name: "daily", at: at, targets: subs("Kyiv", "kyiv ", "Lviv"), want: []string{"Kyiv", "Lviv"}},
+		{name: "hourly at the same moment", at: at, targets: subs("KYIV", "Odesa", "Lviv"), want: []string{"Odesa"}},
+		{name: "nothing new", at: at, targets: subs("Odesa"), want: nil},
+		{name: "next hour", at: at.Add(time.Hour), targets: subs("Kyiv", "Odesa"), want: []string{"Kyiv", "Odesa"}},
+	}
+
+	for _, step := range steps {
+		var got []string
+		for _, sub := range m.unprewarmed(step.targets, step.at) {
+			got = append(got, sub.City)
+		}
+		if !slices.Equal(got, step.want) {
+			t.Errorf("%s: unprewarmed = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxLineLength is the line length recommended by RFC 5322, excluding CRLF.
+	maxLineLength   = 78
+	base64LineWidth = 76
+)
+
+var ErrHeaderInjection = errors.New("header value contains a line break")
+
+// composeMessage renders the email as an RFC 5322 message. Emails with
+// an HTML part are sent as multipart/alternative with the plain text first.
+// Invalid recipients and header values are reported as permanent errors.
+func composeMessage(from mail.Address, email Email) ([]byte, error) {
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return nil, &PermanentError{Err: errors.Wrapf(err, "invalid recipient %q", email.To)}
+	}
+
+	if err := checkHeaderValue(email.Subject); err != nil {
+		return nil, &PermanentError{Err: errors.Wrap(err, "subject")}
+	}
+
+	names := make([]string, 0, len(email.Headers))
+	for name, value := range email.Headers {
+		if err := checkHeader(name, value); err != nil {
+			return nil, &PermanentError{Err: err}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var msg bytes.Buffer
+	writeHeader(&msg, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(&msg, "Message-ID", messageID(from.Address))
+	writeHeader(&msg, "From", from.String())
+	writeHeader(&msg, "To", to.String())
+	writeHeader(&msg, "Subject", mime.QEncoding.Encode("utf-8", email.Subject))
+	for _, name := range names {
+		writeHeader(&msg, name, email.Headers[name])
+	}
+	writeHeader(&msg, "MIME-Version", "1.0")
+
+	if email.HTML == "" {
+		encoding, body := encodeBody(email.Body)
+		writeHeader(&msg, "Content-Type", "text/plain; charset=UTF-8")
+		writeHeader(&msg, "Content-Transfer-Encoding", encoding)
+		msg.WriteString("\r\n")
+		msg.Write(body)
+
+		return msg.Bytes(), nil
+	}
+
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+	if err := writePart(mw, "text/plain; charset=UTF-8", email.Body); err != nil {
+		return nil, err
+	}
+	if err := writePart(mw, "text/html; charset=UTF-8", email.HTML); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, errors.Wrap(err, "unable to close multipart body")
+	}
+
+	writeHeader(&msg, "Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{
+		"boundary": mw.Boundary(),
+	}))
+	msg.WriteString("\r\n")
+	msg.Write(parts.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// reservedHeaders are always set by composeMessage and can't be overridden.
+var reservedHeaders = map[string]bool{
+	"Date":                      true,
+	"Message-Id":                true,
+	"From":                      true,
+	"To":                        true,
+	"Subject":                   true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+}
+
+func checkHeader(name, value string) error {
+	if name == "" || strings.IndexFunc(name, func(r rune) bool { return r <= ' ' || r > '~' || r == ':' }) >= 0 {
+		return errors.Errorf("invalid header name %q", name)
+	}
+	if reservedHeaders[textproto.CanonicalMIMEHeaderKey(name)] {
+		return errors.Errorf("header %s can't be overridden", name)
+	}
+
+	return errors.Wrap(checkHeaderValue(value), name)
+}
+
+func checkHeaderValue(value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return ErrHeaderInjection
+	}
+
+	return nil
+}
+
+// writeHeader writes the header field folding it at spaces, so that
+// lines stay within maxLineLength where the value allows it.
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	line := name + ":"
+	for _, word := range strings.Split(value, " ") {
+		if len(line)+1+len(word) > maxLineLength && strings.TrimSpace(line) != name+":" {
+			buf.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += " " + word
+	}
+	buf.WriteString(line + "\r\n")
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+
+	buf := make([]byte, 16)
+	// crypto/rand never fails on supported platforms.
+	_, _ = rand.Read(buf)
+
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(buf), domain)
+}
+
+func writePart(mw *multipart.Writer, contentType, body string) error {
+	encoding, encoded := encodeBody(body)
+
+	w, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {encoding},
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to create body part")
+	}
+
+	_, err = w.Write(encoded)
+	return errors.Wrap(err, "unable to write body part")
+}
+
+// encodeBody picks the cheapest transfer encoding for the body: 7bit for
+// short-lined ASCII, base64 for mostly non-ASCII text (e.g. Cyrillic) and
+// quoted-printable otherwise.
+func encodeBody(body string) (string, []byte) {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+
+	nonASCII, longLines := 0, false
+	for _, line := range strings.Split(body, "\n") {
+		if len(line) > maxLineLength {
+			longLines = true
+		}
+	}
+	for i := 0; i < len(body); i++ {
+		if body[i] >= utf8.RuneSelf {
+			nonASCII++
+		}
+	}
+
+	switch {
+	case nonASCII == 0 && !longLines:
+		return "7bit", []byte(strings.ReplaceAll(body, "\n", "\r\n"))
+	case nonASCII*3 > len(body):
+		encoded := base64.StdEncoding.EncodeToString([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+
+		var buf bytes.Buffer
+		for len(encoded) > base64LineWidth {
+			buf.WriteString(encoded[:base64LineWidth] + "\r\n")
+			encoded = encoded[base64LineWidth:]
+		}
+		buf.WriteString(encoded)
+
+		return "base64", buf.Bytes()
+	default:
+		var buf bytes.Buffer
+		w := quotedprintable.NewWriter(&buf)
+		// Writing into a bytes.Buffer can't fail.
+		_, _ = w.Write([]byte(body))
+		_ = w.Close()
+
+		return "quoted-printable", buf.Bytes()
+	}
+}
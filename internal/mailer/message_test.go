@@ -0,0 +1,213 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// decodeBody reverses encodeBody, normalizing line breaks to LF.
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var decoded []byte
+	switch encoding {
+	case "7bit":
+		decoded = body
+	case "base64":
+		var err error
+		decoded, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(body), "\r\n", ""))
+		if err != nil {
+			t.Fatalf("decode base64: %v", err)
+		}
+	case "quoted-printable":
+		var err error
+		decoded, err = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+		if err != nil {
+			t.Fatalf("decode quoted-printable: %v", err)
+		}
+	default:
+		t.Fatalf("unexpected encoding %q", encoding)
+	}
+
+	return strings.ReplaceAll(string(decoded), "\r\n", "\n")
+}
+
+func TestEncodeBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+	}{
+		{name: "empty", body: "", encoding: "7bit"},
+		{name: "short ASCII lines", body: "Weather in Kyiv\nSunny", encoding: "7bit"},
+		{name: "CRLF line breaks", body: "line one\r\nline two", encoding: "7bit"},
+		{name: "long ASCII line", body: strings.Repeat("sunny ", 20), encoding: "quoted-printable"},
+		{name: "mostly ASCII", body: "Temperature: 21°C, humidity 40%, wind 3 m/s", encoding: "quoted-printable"},
+		{name: "Cyrillic", body: "Погода у Києві\nСонячно, вітер слабкий", encoding: "base64"},
+		{name: "long Cyrillic line", body: strings.Repeat("сонячно ", 30), encoding: "base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoding, body := encodeBody(tt.body)
+			if encoding != tt.encoding {
+				t.Fatalf("encoding = %q, want %q", encoding, tt.encoding)
+			}
+
+			for _, line := range strings.Split(string(body), "\r\n") {
+				if len(line) > maxLineLength {
+					t.Errorf("line of %d bytes exceeds %d: %q", len(line), maxLineLength, line)
+				}
+				if strings.Contains(line, "\n") {
+					t.Errorf("bare LF in %q", line)
+				}
+			}
+
+			want := strings.ReplaceAll(tt.body, "\r\n", "\n")
+			if got := decodeBody(t, encoding, body); got != want {
+				t.Errorf("decoded body = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestComposeMessage(t *testing.T) {
+	from := mail.Address{Name: "Weather", Address: "noreply@example.com"}
+
+	tests := []struct {
+		name          string
+		email         Email
+		wantPermanent bool
+		wantParts     []string
+	}{
+		{
+			name:      "plain text",
+			email:     Email{To: "user@example.com", Subject: "Weather in Kyiv", Body: "Sunny"},
+			wantParts: []string{"text/plain; charset=UTF-8"},
+		},
+		{
+			name: "HTML with headers",
+			email: Email{
+				To:      "Користувач <user@example.com>",
+				Subject: "Погода у Києві",
+				Body:    "Сонячно",
+				HTML:    "<p>Сонячно</p>",
+				Headers: map[string]string{"List-Unsubscribe": "<https://example.com/u>"},
+			},
+			wantParts: []string{"text/plain; charset=UTF-8", "text/html; charset=UTF-8"},
+		},
+		{
+			name:          "invalid recipient",
+			email:         Email{To: "not an address", Subject: "Weather"},
+			wantPermanent: true,
+		},
+		{
+			name:          "subject injection",
+			email:         Email{To: "user@example.com", Subject: "Weather\r\nBcc: victim@example.com"},
+			wantPermanent: true,
+		},
+		{
+			name: "header injection",
+			email: Email{
+				To:      "user@example.com",
+				Headers: map[string]string{"X-Campaign": "daily\nBcc: victim@example.com"},
+			},
+			wantPermanent: true,
+		},
+		{
+			name:          "reserved header",
+			email:         Email{To: "user@example.com", Headers: map[string]string{"from": "someone@example.com"}},
+			wantPermanent: true,
+		},
+		{
+			name:          "invalid header name",
+			email:         Email{To: "user@example.com", Headers: map[string]string{"X Campaign": "daily"}},
+			wantPermanent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := composeMessage(from, tt.email)
+			if tt.wantPermanent {
+				if !IsPermanent(err) {
+					t.Fatalf("composeMessage error = %v, want a permanent error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("composeMessage: %v", err)
+			}
+
+			// Encoded words can't be folded, so header lines may exceed
+			// maxLineLength, but never the hard limit of RFC 5322.
+			for _, line := range strings.Split(string(raw), "\r\n") {
+				if len(line) > 998 {
+					t.Errorf("line of %d bytes exceeds 998: %q", len(line), line)
+				}
+			}
+
+			msg, err := mail.ReadMessage(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+
+			to, err := msg.Header.AddressList("To")
+			if err != nil || len(to) != 1 || to[0].Address != "user@example.com" {
+				t.Errorf("To = %v (%v), want user@example.com", to, err)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			if err != nil || subject != tt.email.Subject {
+				t.Errorf("Subject = %q (%v), want %q", subject, err, tt.email.Subject)
+			}
+			for name, value := range tt.email.Headers {
+				if got := msg.Header.Get(name); got != value {
+					t.Errorf("%s = %q, want %q", name, got, value)
+				}
+			}
+
+			mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("Content-Type: %v", err)
+			}
+
+			if mediaType != "multipart/alternative" {
+				body, _ := io.ReadAll(msg.Body)
+				if got := decodeBody(t, msg.Header.Get("Content-Transfer-Encoding"), body); got != tt.email.Body {
+					t.Errorf("body = %q, want %q", got, tt.email.Body)
+				}
+				if len(tt.wantParts) != 1 || msg.Header.Get("Content-Type") != tt.wantParts[0] {
+					t.Errorf("Content-Type = %q, want %v", msg.Header.Get("Content-Type"), tt.wantParts)
+				}
+				return
+			}
+
+			bodies := []string{tt.email.Body, tt.email.HTML}
+			reader := multipart.NewReader(msg.Body, params["boundary"])
+			for i, wantType := range tt.wantParts {
+				part, err := reader.NextRawPart()
+				if err != nil {
+					t.Fatalf("part %d: %v", i, err)
+				}
+				if got := part.Header.Get("Content-Type"); got != wantType {
+					t.Errorf("part %d Content-Type = %q, want %q", i, got, wantType)
+				}
+
+				body, _ := io.ReadAll(part)
+				if got := decodeBody(t, part.Header.Get("Content-Transfer-Encoding"), body); got != bodies[i] {
+					t.Errorf("part %d body = %q, want %q", i, got, bodies[i])
+				}
+			}
+			if _, err := reader.NextRawPart(); err != io.EOF {
+				t.Errorf("expected %d parts, got more (%v)", len(tt.wantParts), err)
+			}
+		})
+	}
+}
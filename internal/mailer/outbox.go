@@ -0,0 +1,177 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+	"weather/internal/config"
+	"weather/internal/models"
+	"weather/internal/srverrors"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	outboxUpdateTimeout       = 5 * time.Second
+	defaultOutboxPollInterval = 5 * time.Second
+)
+
+type OutboxStore interface {
+	Enqueue(ctx context.Context, msgs []models.OutboxMessage) error
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error)
+	MarkSent(ctx context.Context, id int64, attempt int) error
+	MarkFailed(ctx context.Context, id int64, attempt int, reason string, retryAt time.Time) error
+	MarkDead(ctx context.Context, id int64, attempt int, reason string) error
+}
+
+// OutboxRelay moves messages from the outbox table to the dispatcher,
+// retrying failed ones with exponential backoff until they are dead-lettered.
+type OutboxRelay struct {
+	store      OutboxStore
+	dispatcher *Dispatcher
+	config     config.OutboxConfig
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewOutboxRelay(store OutboxStore, dispatcher *Dispatcher, config config.OutboxConfig) *OutboxRelay {
+	config.BatchSize = max(config.BatchSize, 1)
+	config.MaxAttempts = max(config.MaxAttempts, 1)
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaultOutboxPollInterval
+	}
+
+	return &OutboxRelay{
+		store:      store,
+		dispatcher: dispatcher,
+		config:     config,
+	}
+}
+
+// Message converts an email into an outbox row with the configured attempt limit.
+func (r *OutboxRelay) Message(email Email) models.OutboxMessage {
+	return models.OutboxMessage{
+		Recipient:   email.To,
+		Subject:     email.Subject,
+		Body:        email.Body,
+		HTMLBody:    email.HTML,
+		Headers:     email.Headers,
+		MaxAttempts: r.config.MaxAttempts,
+	}
+}
+
+func (r *OutboxRelay) Enqueue(ctx context.Context, emails ...Email) error {
+	msgs := make([]models.OutboxMessage, 0, len(emails))
+	for _, email := range emails {
+		msgs = append(msgs, r.Message(email))
+	}
+
+	return r.store.Enqueue(ctx, msgs)
+}
+
+func (r *OutboxRelay) Start() {
+	r.stopChan = make(chan struct{})
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.config.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			// Keep draining while full batches come back.
+			for r.relay() == r.config.BatchSize {
+				select {
+				case <-r.stopChan:
+					return
+				default:
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-r.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the batch in flight to be handled.
+func (r *OutboxRelay) Stop() {
+	close(r.stopChan)
+	r.wg.Wait()
+}
+
+// relay sends one claimed batch and reports how many messages it contained.
+func (r *OutboxRelay) relay() int {
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.Lease)
+	defer cancel()
+
+	msgs, err := r.store.Claim(ctx, r.config.BatchSize, r.config.Lease)
+	if err != nil {
+		log.Printf("outbox claim error: %v\n", err)
+		return 0
+	}
+
+	batch := r.dispatcher.NewBatch()
+	for _, msg := range msgs {
+		email := Email{
+			To:      msg.Recipient,
+			Subject: msg.Subject,
+			Body:    msg.Body,
+			HTML:    msg.HTMLBody,
+			Headers: msg.Headers,
+		}
+		if err := r.dispatcher.Submit(ctx, batch, email, r.reporter(msg)); err != nil {
+			// The lease expires and the message is claimed again.
+			log.Printf("outbox submit error for message %d: %v\n", msg.ID, err)
+		}
+	}
+
+	result := batch.Wait()
+	if len(msgs) > 0 {
+		log.Printf("outbox batch: %d sent, %d failed\n", result.Sent, result.Failed)
+	}
+
+	return len(msgs)
+}
+
+func (r *OutboxRelay) reporter(msg models.OutboxMessage) func(error) {
+	return func(sendErr error) {
+		ctx, cancel := context.WithTimeout(context.Background(), outboxUpdateTimeout)
+		defer cancel()
+
+		var err error
+		switch {
+		case sendErr == nil:
+			err = r.store.MarkSent(ctx, msg.ID, msg.Attempts)
+		case IsPermanent(sendErr) || msg.Attempts >= msg.MaxAttempts:
+			log.Printf("outbox message %d is dead after %d attempts: %v\n", msg.ID, msg.Attempts, sendErr)
+			err = r.store.MarkDead(ctx, msg.ID, msg.Attempts, sendErr.Error())
+		default:
+			err = r.store.MarkFailed(ctx, msg.ID, msg.Attempts, sendErr.Error(), time.Now().Add(r.backoff(msg.Attempts)))
+		}
+
+		switch {
+		case errors.Is(err, srverrors.ErrorLeaseLost):
+			// Another relay claimed it after the lease expired; its result counts.
+			log.Printf("outbox message %d: lost the lease, result dropped\n", msg.ID)
+		case err != nil:
+			log.Printf("outbox update error for message %d: %v\n", msg.ID, err)
+		}
+	}
+}
+
+// backoff doubles the base delay with every attempt, up to the maximum.
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	delay := r.config.BaseBackoff
+	for i := 1; i < attempts && delay < r.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, r.config.MaxBackoff)
+}
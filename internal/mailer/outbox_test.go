@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"testing"
+	"time"
+	"weather/internal/config"
+)
+
+func TestOutboxRelayBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     time.Duration
+		max      time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{name: "first attempt", base: time.Second, max: time.Hour, attempts: 1, want: time.Second},
+		{name: "no attempt yet", base: time.Second, max: time.Hour, attempts: 0, want: time.Second},
+		{name: "second attempt", base: time.Second, max: time.Hour, attempts: 2, want: 2 * time.Second},
+		{name: "fifth attempt", base: time.Second, max: time.Hour, attempts: 5, want: 16 * time.Second},
+		{name: "capped", base: time.Second, max: 10 * time.Second, attempts: 5, want: 10 * time.Second},
+		{name: "many attempts", base: time.Second, max: time.Hour, attempts: 1000, want: time.Hour},
+		{name: "maximum below base", base: time.Minute, max: time.Second, attempts: 1, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := NewOutboxRelay(nil, nil, config.OutboxConfig{BaseBackoff: tt.base, MaxBackoff: tt.max})
+			if got := relay.backoff(tt.attempts); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
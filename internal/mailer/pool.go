@@ -0,0 +1,314 @@
+package mailer
+
+import (
+	"context"
+	joinErr "errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	smtpDialTimeout      = 10 * time.Second
+	smtpHealthCheckAfter = 10 * time.Second
+	smtpQuitTimeout      = 5 * time.Second
+)
+
+var ErrPoolClosed = errors.New("SMTP pool is closed")
+
+// dialFunc connects and authenticates, returning the client together
+// with its underlying connection, which deadlines are set on.
+type dialFunc func(ctx context.Context) (*smtp.Client, net.Conn, error)
+
+// session is an authenticated SMTP connection that may send many messages.
+type session struct {
+	client   *smtp.Client
+	conn     net.Conn
+	sent     int
+	lastUsed time.Time
+}
+
+// bind makes I/O on the session time out at the deadline of ctx and fail
+// as soon as ctx is done. The returned func undoes it and reports whether
+// the session is still usable.
+func (s *session) bind(ctx context.Context) func() bool {
+	deadline, _ := ctx.Deadline()
+	_ = s.conn.SetDeadline(deadline)
+
+	stop := context.AfterFunc(ctx, func() {
+		_ = s.conn.SetDeadline(time.Now())
+	})
+
+	return func() bool {
+		if !stop() {
+			return false
+		}
+		return s.conn.SetDeadline(time.Time{}) == nil
+	}
+}
+
+func (s *session) send(from, to string, msg []byte) error {
+	if s.sent > 0 {
+		if err := s.client.Reset(); err != nil {
+			return errors.Wrap(err, "reset session")
+		}
+	}
+
+	if err := s.client.Mail(from); err != nil {
+		return errors.Wrap(err, "set sender")
+	}
+	if err := s.client.Rcpt(to); err != nil {
+		return errors.Wrap(err, "set recipient")
+	}
+
+	wc, err := s.client.Data()
+	if err != nil {
+		return errors.Wrap(err, "get data writer")
+	}
+
+	if _, err := wc.Write(msg); err != nil {
+		closeErr := wc.Close()
+		return joinErr.Join(errors.Wrap(err, "write email body"), closeErr)
+	}
+
+	if err := wc.Close(); err != nil {
+		return errors.Wrap(err, "failed to close write closer")
+	}
+
+	s.sent++
+	return nil
+}
+
+func (s *session) close() error {
+	_ = s.conn.SetDeadline(time.Now().Add(smtpQuitTimeout))
+
+	if err := s.client.Quit(); err != nil {
+		return joinErr.Join(errors.Wrap(err, "failed to quit client"), s.client.Close())
+	}
+
+	return nil
+}
+
+// SMTPPool keeps up to size authenticated SMTP sessions open and reuses
+// them between messages, reconnecting when a session turns out to be broken.
+type SMTPPool struct {
+	dial        dialFunc
+	idleTimeout time.Duration
+	maxMessages int
+
+	slots chan struct{}
+
+	mx     sync.Mutex
+	idle   []*session
+	closed bool
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewSMTPPool(dial dialFunc, size int, idleTimeout time.Duration, maxMessages int) *SMTPPool {
+	p := &SMTPPool{
+		dial:        dial,
+		idleTimeout: idleTimeout,
+		maxMessages: maxMessages,
+		slots:       make(chan struct{}, max(size, 1)),
+		stopChan:    make(chan struct{}),
+	}
+
+	if idleTimeout > 0 {
+		p.wg.Add(1)
+		go p.reap()
+	}
+
+	return p
+}
+
+// Send delivers the message over a pooled session, giving up when ctx is
+// done. Connection failures are retried once over a fresh session; SMTP
+// replies are returned as is.
+func (p *SMTPPool) Send(ctx context.Context, from, to string, msg []byte) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	s, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = p.sendOver(ctx, s, from, to, msg)
+	if err == nil || isSMTPReply(err) {
+		return err
+	}
+	if ctx.Err() != nil {
+		return joinErr.Join(err, ctx.Err())
+	}
+
+	s, retryErr := p.connect(ctx)
+	if retryErr != nil {
+		return joinErr.Join(err, retryErr)
+	}
+
+	if retryErr = p.sendOver(ctx, s, from, to, msg); retryErr != nil && !isSMTPReply(retryErr) {
+		return joinErr.Join(err, retryErr)
+	}
+
+	return retryErr
+}
+
+// sendOver sends the message and returns the session to the pool, or
+// closes it after a connection failure. A rejected MAIL, RCPT or DATA
+// leaves the transaction open, so the session is reset before it is
+// reused and closed if that fails. A session interrupted by ctx is closed.
+func (p *SMTPPool) sendOver(ctx context.Context, s *session, from, to string, msg []byte) error {
+	unbind := s.bind(ctx)
+
+	err := s.send(from, to, msg)
+	reusable := err == nil || isSMTPReply(err)
+	if err != nil && reusable {
+		reusable = s.client.Reset() == nil
+	}
+
+	if !unbind() || !reusable {
+		p.discard(s)
+		return err
+	}
+
+	p.put(s)
+	return err
+}
+
+func isSMTPReply(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr)
+}
+
+func (p *SMTPPool) get(ctx context.Context) (*session, error) {
+	for {
+		p.mx.Lock()
+		if p.closed {
+			p.mx.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if len(p.idle) == 0 {
+			p.mx.Unlock()
+			return p.connect(ctx)
+		}
+		s := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mx.Unlock()
+
+		idleFor := time.Since(s.lastUsed)
+		if p.idleTimeout > 0 && idleFor > p.idleTimeout {
+			p.discard(s)
+			continue
+		}
+		if idleFor > smtpHealthCheckAfter {
+			unbind := s.bind(ctx)
+			err := s.client.Noop()
+			if !unbind() || err != nil {
+				p.discard(s)
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				continue
+			}
+		}
+
+		return s, nil
+	}
+}
+
+func (p *SMTPPool) connect(ctx context.Context) (*session, error) {
+	client, conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session{client: client, conn: conn, lastUsed: time.Now()}, nil
+}
+
+func (p *SMTPPool) put(s *session) {
+	if p.maxMessages > 0 && s.sent >= p.maxMessages {
+		p.discard(s)
+		return
+	}
+
+	s.lastUsed = time.Now()
+
+	p.mx.Lock()
+	if p.closed {
+		p.mx.Unlock()
+		p.discard(s)
+		return
+	}
+	p.idle = append(p.idle, s)
+	p.mx.Unlock()
+}
+
+func (p *SMTPPool) discard(s *session) {
+	// The session is dropped anyway, a failed QUIT only means
+	// the server has already hung up.
+	_ = s.close()
+}
+
+func (p *SMTPPool) reap() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.mx.Lock()
+			var expired []*session
+			alive := p.idle[:0]
+			for _, s := range p.idle {
+				if time.Since(s.lastUsed) > p.idleTimeout {
+					expired = append(expired, s)
+				} else {
+					alive = append(alive, s)
+				}
+			}
+			p.idle = alive
+			p.mx.Unlock()
+
+			for _, s := range expired {
+				p.discard(s)
+			}
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+// Close quits every idle session. Sessions in use are closed when returned.
+func (p *SMTPPool) Close() error {
+	p.mx.Lock()
+	if p.closed {
+		p.mx.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mx.Unlock()
+
+	close(p.stopChan)
+	p.wg.Wait()
+
+	var err error
+	for _, s := range idle {
+		err = joinErr.Join(err, s.close())
+	}
+
+	return err
+}
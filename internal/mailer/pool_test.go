@@ -0,0 +1,216 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestPool returns a pool of plaintext sessions to the server.
+func newTestPool(t *testing.T, server *fakeSMTPServer, idleTimeout time.Duration, maxMessages int) *SMTPPool {
+	t.Helper()
+
+	dial := func(ctx context.Context) (*smtp.Client, net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", server.listener.Addr().String())
+		if err != nil {
+			return nil, nil, err
+		}
+		client, err := smtp.NewClient(conn, "127.0.0.1")
+		if err != nil {
+			return nil, nil, closeOnError(conn, err)
+		}
+		return client, conn, nil
+	}
+
+	p := NewSMTPPool(dial, 1, idleTimeout, maxMessages)
+	t.Cleanup(func() { _ = p.Close() })
+
+	return p
+}
+
+func poolSend(t *testing.T, p *SMTPPool) error {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return p.Send(ctx, "from@example.com", "to@example.com", []byte("Subject: test\r\n\r\nhello\r\n"))
+}
+
+func count(commands []string, verb string) int {
+	n := 0
+	for _, c := range commands {
+		if c == verb {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSMTPPoolReuse(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	p := newTestPool(t, server, 0, 0)
+
+	for range 3 {
+		if err := poolSend(t, p); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	commands, connections, _, messages := server.stats()
+	if connections != 1 {
+		t.Errorf("connections = %d, want 1", connections)
+	}
+	if messages != 3 {
+		t.Errorf("messages = %d, want 3", messages)
+	}
+	if n := count(commands, "RSET"); n != 2 {
+		t.Errorf("RSET sent %d times, want 2 (before every message but the first)", n)
+	}
+	if n := count(commands, "NOOP"); n != 0 {
+		t.Errorf("NOOP sent %d times to a recently used session, want 0", n)
+	}
+}
+
+func TestSMTPPoolBrokenSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		verb    string
+		line    string
+		stale   bool
+		wantErr bool
+	}{
+		{name: "RSET hangs up", verb: "RSET", line: ""},
+		{name: "RSET rejected", verb: "RSET", line: "421 closing", wantErr: true},
+		{name: "NOOP hangs up", verb: "NOOP", line: "", stale: true},
+		{name: "NOOP rejected", verb: "NOOP", line: "421 closing", stale: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeSMTPServer(t, false)
+			p := newTestPool(t, server, 0, 0)
+
+			if err := poolSend(t, p); err != nil {
+				t.Fatalf("first Send: %v", err)
+			}
+
+			server.reply(tt.verb, tt.line)
+			if tt.stale {
+				// Old enough to be checked with NOOP before reuse.
+				p.mx.Lock()
+				p.idle[0].lastUsed = time.Now().Add(-2 * smtpHealthCheckAfter)
+				p.mx.Unlock()
+			}
+
+			err := poolSend(t, p)
+			if tt.wantErr {
+				var protoErr *textproto.Error
+				if !errors.As(err, &protoErr) || protoErr.Code != 421 {
+					t.Fatalf("second Send error = %v, want the 421 reply", err)
+				}
+			} else if err != nil {
+				t.Fatalf("second Send: %v", err)
+			}
+
+			server.restore(tt.verb)
+			if err := poolSend(t, p); err != nil {
+				t.Fatalf("third Send: %v", err)
+			}
+
+			waitFor(t, func() bool {
+				_, _, open, _ := server.stats()
+				return open == 1
+			})
+			commands, connections, _, messages := server.stats()
+			if connections != 2 {
+				t.Errorf("connections = %d, want 2", connections)
+			}
+			wantMessages := 3
+			if tt.wantErr {
+				wantMessages = 2
+			}
+			if messages != wantMessages {
+				t.Errorf("messages = %d, want %d", messages, wantMessages)
+			}
+			if !slices.Contains(commands, tt.verb) {
+				t.Errorf("commands %v lack %s", commands, tt.verb)
+			}
+		})
+	}
+}
+
+func TestSMTPPoolMaxMessages(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	p := newTestPool(t, server, 0, 2)
+
+	for range 5 {
+		if err := poolSend(t, p); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	waitFor(t, func() bool {
+		_, _, open, _ := server.stats()
+		return open == 1
+	})
+	commands, connections, _, messages := server.stats()
+	if connections != 3 {
+		t.Errorf("connections = %d, want 3", connections)
+	}
+	if messages != 5 {
+		t.Errorf("messages = %d, want 5", messages)
+	}
+	if n := count(commands, "QUIT"); n != 2 {
+		t.Errorf("QUIT sent %d times, want 2", n)
+	}
+}
+
+func TestSMTPPoolReaper(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	p := newTestPool(t, server, 50*time.Millisecond, 0)
+
+	if err := poolSend(t, p); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	server.idle(t)
+	p.mx.Lock()
+	idle := len(p.idle)
+	p.mx.Unlock()
+	if idle != 0 {
+		t.Errorf("%d idle sessions after reaping, want 0", idle)
+	}
+	if commands, _, _, _ := server.stats(); !slices.Contains(commands, "QUIT") {
+		t.Errorf("commands %v lack QUIT", commands)
+	}
+
+	if err := poolSend(t, p); err != nil {
+		t.Fatalf("Send after reaping: %v", err)
+	}
+	if _, connections, _, _ := server.stats(); connections != 2 {
+		t.Errorf("connections = %d, want 2", connections)
+	}
+}
+
+func TestSMTPPoolClose(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	p := newTestPool(t, server, time.Minute, 0)
+
+	if err := poolSend(t, p); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	server.idle(t)
+	if err := poolSend(t, p); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Send after Close error = %v, want %v", err, ErrPoolClosed)
+	}
+}
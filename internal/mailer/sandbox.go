@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"context"
+	"net/mail"
+	"sync"
+	"time"
+)
+
+type StoredEmail struct {
+	ID      int64             `json:"id"`
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Subject string            `json:"subject"`
+	Body    string            `json:"body"`
+	HTML    string            `json:"html,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	SentAt  time.Time         `json:"sent_at"`
+}
+
+// SandboxTransport keeps the last capacity emails in memory instead of
+// delivering them, so they can be inspected through the dev mailbox.
+type SandboxTransport struct {
+	from mail.Address
+
+	mx     sync.RWMutex
+	ring   []StoredEmail
+	head   int
+	count  int
+	nextID int64
+}
+
+func NewSandboxTransport(capacity int, from mail.Address) *SandboxTransport {
+	return &SandboxTransport{
+		from: from,
+		ring: make([]StoredEmail, max(capacity, 1)),
+	}
+}
+
+func (t *SandboxTransport) Send(_ context.Context, email Email) error {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	t.nextID++
+	t.ring[t.head] = StoredEmail{
+		ID:      t.nextID,
+		From:    t.from.String(),
+		To:      email.To,
+		Subject: email.Subject,
+		Body:    email.Body,
+		HTML:    email.HTML,
+		Headers: email.Headers,
+		SentAt:  time.Now(),
+	}
+	t.head = (t.head + 1) % len(t.ring)
+	t.count = min(t.count+1, len(t.ring))
+
+	return nil
+}
+
+// List returns the stored emails, newest first.
+func (t *SandboxTransport) List() []StoredEmail {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	emails := make([]StoredEmail, 0, t.count)
+	for i := 1; i <= t.count; i++ {
+		emails = append(emails, t.ring[(t.head-i+len(t.ring))%len(t.ring)])
+	}
+
+	return emails
+}
+
+func (t *SandboxTransport) Get(id int64) (StoredEmail, bool) {
+	for _, email := range t.List() {
+		if email.ID == id {
+			return email, true
+		}
+	}
+
+	return StoredEmail{}, false
+}
+
+func (t *SandboxTransport) Clear() {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	t.ring = make([]StoredEmail, len(t.ring))
+	t.head = 0
+	t.count = 0
+}
+
+func (t *SandboxTransport) Close() error {
+	return nil
+}
@@ -4,116 +4,145 @@ import (
 	"context"
 	"crypto/tls"
 	joinErr "errors"
-	"fmt"
-	"log"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"strings"
+	"time"
 	"weather/internal/config"
-	"weather/internal/models"
 
 	"github.com/pkg/errors"
 )
 
+const (
+	SecurityImplicitTLS = "implicit-tls"
+	SecurityStartTLS    = "starttls"
+	SecurityNone        = "none"
+)
+
+var ErrUnknownSecurity = errors.New("unknown SMTP security mode")
+
 type SMTPMailer struct {
-	User         string
-	Password     string
 	Host         string
 	Port         string
-	emailBuilder *EmailBuilder
+	Security     string
+	EnvelopeFrom string
+	From         mail.Address
+	auth         smtp.Auth
+	pool         *SMTPPool
 }
 
-func NewSMTPMailer(config config.SMTPConfig, emailBuilder *EmailBuilder) *SMTPMailer {
-	return &SMTPMailer{
-		User:         config.SMTPUser,
-		Password:     config.SMTPPassword,
+func NewSMTPMailer(config config.SMTPConfig) (*SMTPMailer, error) {
+	security := strings.ToLower(config.Security)
+	switch security {
+	case SecurityImplicitTLS, SecurityStartTLS, SecurityNone:
+	case "":
+		security = SecurityImplicitTLS
+	default:
+		return nil, errors.Wrap(ErrUnknownSecurity, config.Security)
+	}
+
+	auth, err := newAuth(config.AuthMechanism, config.SMTPUser, config.SMTPPassword, config.SMTPHost)
+	if err != nil {
+		return nil, err
+	}
+
+	from := sender(config)
+	envelopeFrom := config.EnvelopeFrom
+	if envelopeFrom == "" {
+		envelopeFrom = from.Address
+	}
+
+	m := &SMTPMailer{
 		Host:         config.SMTPHost,
 		Port:         config.SMTPPort,
-		emailBuilder: emailBuilder,
+		Security:     security,
+		EnvelopeFrom: envelopeFrom,
+		From:         from,
+		auth:         auth,
 	}
+	m.pool = NewSMTPPool(m.dial, config.PoolSize, config.IdleTimeout, config.MaxMessagesPerConn)
+
+	return m, nil
 }
 
-func (m *SMTPMailer) sendEmails(
-	ctx context.Context,
-	forecasts []models.Forecast,
-	subjectPrefix string,
-) {
-	for _, f := range forecasts {
-		subj, body := m.emailBuilder.BuildWeatherForecastEmail(ctx, f.Email, f.City, f.Weather)
-
-		go func(email, subj, msg string) {
-			if err := m.SendEmail(email, subj, msg); err != nil {
-				log.Printf("email error to %s: %v\n", email, err)
-			}
-		}(f.Email, subjectPrefix+subj, body)
+func closeOnError(closer interface{ Close() error }, err error) error {
+	if closeErr := closer.Close(); closeErr != nil {
+		err = joinErr.Join(err, closeErr)
 	}
-}
 
-func (m *SMTPMailer) SendEmail(to, subject, body string) (err error) {
-	var msg strings.Builder
-	msg.WriteString(fmt.Sprintf("From: %s\r\n", m.User))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", to))
-	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
-	msg.WriteString("\r\n")
-	msg.WriteString(body)
+	return err
+}
 
-	auth := smtp.PlainAuth("", m.User, m.Password, m.Host)
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, net.Conn, error) {
 	tlsConf := &tls.Config{InsecureSkipVerify: false, ServerName: m.Host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+	addr := net.JoinHostPort(m.Host, m.Port)
 
-	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%s", m.Host, m.Port), tlsConf)
+	var (
+		conn net.Conn
+		err  error
+	)
+	if m.Security == SecurityImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConf}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
 	if err != nil {
-		return errors.Wrap(err, "connect SMTP")
+		return nil, nil, errors.Wrap(err, "connect SMTP")
+	}
+
+	// The greeting, STARTTLS and AUTH share the dial timeout.
+	deadline := time.Now().Add(smtpDialTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, nil, closeOnError(conn, errors.Wrap(err, "set SMTP deadline"))
 	}
 
 	client, err := smtp.NewClient(conn, m.Host)
 	if err != nil {
-		err = errors.Wrap(err, "new SMTP client")
-		if closeErr := conn.Close(); closeErr != nil {
-			err = joinErr.Join(err, closeErr)
-		}
-		return err
+		return nil, nil, closeOnError(conn, errors.Wrap(err, "new SMTP client"))
 	}
 
-	defer func() {
-		quitErr := client.Quit()
-		if quitErr != nil {
-			quitErr = errors.Wrap(quitErr, "failed to quit client")
-			if err != nil {
-				err = joinErr.Join(err, quitErr)
-			} else {
-				err = quitErr
-			}
+	if m.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return nil, nil, closeOnError(client, errors.New("SMTP server doesn't support STARTTLS"))
+		}
+		if err := client.StartTLS(tlsConf); err != nil {
+			return nil, nil, closeOnError(client, errors.Wrap(err, "SMTP STARTTLS"))
 		}
-	}()
-
-	if err := client.Auth(auth); err != nil {
-		return errors.Wrap(err, "SMTP auth")
-	}
-	if err := client.Mail(m.User); err != nil {
-		return errors.Wrap(err, "set sender")
 	}
-	if err := client.Rcpt(to); err != nil {
-		return errors.Wrap(err, "set recipient")
+
+	if m.auth != nil {
+		if err := client.Auth(m.auth); err != nil {
+			return nil, nil, closeOnError(client, errors.Wrap(err, "SMTP auth"))
+		}
 	}
 
-	wc, err := client.Data()
+	return client, conn, nil
+}
+
+// Send gives up when ctx is done, also while waiting for the server.
+func (m *SMTPMailer) Send(ctx context.Context, email Email) error {
+	msg, err := composeMessage(m.From, email)
 	if err != nil {
-		return errors.Wrap(err, "get data writer")
+		return err
 	}
 
-	defer func() {
-		closeErr := wc.Close()
-		if closeErr != nil {
-			closeErr = errors.Wrap(closeErr, "failed to close write closer")
-			if err != nil {
-				err = joinErr.Join(err, closeErr)
-			} else {
-				err = closeErr
-			}
-		}
-	}()
+	err = m.pool.Send(ctx, m.EnvelopeFrom, email.To, msg)
 
-	if _, err := wc.Write([]byte(msg.String())); err != nil {
-		return errors.Wrap(err, "write email body")
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return &PermanentError{Err: err}
 	}
-	return nil
+
+	return err
+}
+
+// Close quits the pooled SMTP sessions.
+func (m *SMTPMailer) Close() error {
+	return m.pool.Close()
 }
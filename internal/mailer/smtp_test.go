@@ -0,0 +1,464 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"weather/internal/config"
+)
+
+// fakeSMTPServer speaks just enough SMTP for the client in net/smtp and
+// records the commands it receives.
+type fakeSMTPServer struct {
+	listener net.Listener
+	startTLS bool
+
+	mx          sync.Mutex
+	commands    []string
+	replies     map[string]string
+	credentials []string
+	messages    int
+	connections int
+	open        int
+
+	wg sync.WaitGroup
+}
+
+func newFakeSMTPServer(t *testing.T, startTLS bool) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	s := &fakeSMTPServer{listener: listener, startTLS: startTLS, replies: make(map[string]string)}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mx.Lock()
+			s.connections++
+			s.open++
+			s.mx.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+		s.wg.Wait()
+	})
+
+	return s
+}
+
+// reply makes the server answer the command with the line from now on.
+// A 421 reply also closes the connection, an empty line hangs up without
+// replying.
+func (s *fakeSMTPServer) reply(verb, line string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.replies[verb] = line
+}
+
+// restore makes the server answer the command normally again.
+func (s *fakeSMTPServer) restore(verb string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	delete(s.replies, verb)
+}
+
+func (s *fakeSMTPServer) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+// idle waits until every connection to the server is closed.
+func (s *fakeSMTPServer) idle(t *testing.T) {
+	t.Helper()
+
+	waitFor(t, func() bool {
+		_, _, open, _ := s.stats()
+		return open == 0
+	})
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(3 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *fakeSMTPServer) stats() (commands []string, connections, open, messages int) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return slices.Clone(s.commands), s.connections, s.open, s.messages
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+		s.mx.Lock()
+		s.open--
+		s.mx.Unlock()
+	}()
+
+	tp := textproto.NewConn(conn)
+	if err := tp.PrintfLine("220 fake ESMTP"); err != nil {
+		return
+	}
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+
+		s.mx.Lock()
+		s.commands = append(s.commands, verb)
+		reply, rejected := s.replies[verb]
+		s.mx.Unlock()
+
+		if rejected {
+			if reply == "" {
+				return
+			}
+			_ = tp.PrintfLine("%s", reply)
+			if strings.HasPrefix(reply, "421") {
+				return
+			}
+			continue
+		}
+
+		switch verb {
+		case "EHLO":
+			lines := []string{"250-fake"}
+			if s.startTLS {
+				lines = append(lines, "250-STARTTLS")
+			}
+			lines = append(lines, "250 AUTH PLAIN LOGIN")
+			for _, l := range lines {
+				_ = tp.PrintfLine("%s", l)
+			}
+		case "STARTTLS":
+			// No certificate the client trusts; hanging up fails the handshake.
+			_ = tp.PrintfLine("220 ready")
+			return
+		case "AUTH":
+			if !s.auth(tp, arg) {
+				return
+			}
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			if _, err := tp.ReadDotBytes(); err != nil {
+				return
+			}
+			s.mx.Lock()
+			s.messages++
+			s.mx.Unlock()
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		case "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+			_ = tp.PrintfLine("250 ok")
+		default:
+			_ = tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// auth runs AUTH LOGIN and records the credentials; other mechanisms are
+// accepted right away.
+func (s *fakeSMTPServer) auth(tp *textproto.Conn, arg string) bool {
+	if !strings.EqualFold(arg, "LOGIN") {
+		return tp.PrintfLine("235 accepted") == nil
+	}
+
+	var credentials []string
+	for _, challenge := range []string{"Username:", "Password:"} {
+		if err := tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge))); err != nil {
+			return false
+		}
+		line, err := tp.ReadLine()
+		if err != nil {
+			return false
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return false
+		}
+		credentials = append(credentials, string(decoded))
+	}
+
+	s.mx.Lock()
+	s.credentials = append(s.credentials, strings.Join(credentials, ":"))
+	s.mx.Unlock()
+
+	return tp.PrintfLine("235 accepted") == nil
+}
+
+func TestNewSMTPMailerSecurity(t *testing.T) {
+	tests := []struct {
+		security string
+		want     string
+		wantErr  error
+	}{
+		{security: "", want: SecurityImplicitTLS},
+		{security: "implicit-tls", want: SecurityImplicitTLS},
+		{security: "STARTTLS", want: SecurityStartTLS},
+		{security: "none", want: SecurityNone},
+		{security: "ssl", wantErr: ErrUnknownSecurity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.security, func(t *testing.T) {
+			m, err := NewSMTPMailer(config.SMTPConfig{SMTPHost: "mail.example.com", Security: tt.security, AuthMechanism: AuthNone})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewSMTPMailer error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer m.Close()
+
+			if m.Security != tt.want {
+				t.Errorf("Security = %q, want %q", m.Security, tt.want)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerDial(t *testing.T) {
+	tests := []struct {
+		name          string
+		security      string
+		auth          string
+		startTLS      bool
+		wantErr       string
+		wantCommands  []string
+		avoidCommands []string
+	}{
+		{
+			name:          "plaintext with login auth",
+			security:      SecurityNone,
+			auth:          AuthLogin,
+			wantCommands:  []string{"EHLO", "AUTH"},
+			avoidCommands: []string{"STARTTLS"},
+		},
+		{
+			name:          "plaintext without auth",
+			security:      SecurityNone,
+			auth:          AuthNone,
+			avoidCommands: []string{"STARTTLS", "AUTH"},
+		},
+		{
+			name:          "STARTTLS before auth",
+			security:      SecurityStartTLS,
+			auth:          AuthLogin,
+			startTLS:      true,
+			wantErr:       "SMTP STARTTLS",
+			wantCommands:  []string{"EHLO", "STARTTLS"},
+			avoidCommands: []string{"AUTH"},
+		},
+		{
+			name:          "STARTTLS not offered",
+			security:      SecurityStartTLS,
+			auth:          AuthLogin,
+			wantErr:       "doesn't support STARTTLS",
+			wantCommands:  []string{"EHLO"},
+			avoidCommands: []string{"STARTTLS", "AUTH"},
+		},
+		{
+			name:          "implicit TLS",
+			security:      SecurityImplicitTLS,
+			auth:          AuthLogin,
+			wantErr:       "connect SMTP",
+			avoidCommands: []string{"EHLO", "AUTH"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeSMTPServer(t, tt.startTLS)
+
+			m, err := NewSMTPMailer(config.SMTPConfig{
+				SMTPUser:      "user",
+				SMTPPassword:  "secret",
+				SMTPHost:      "127.0.0.1",
+				SMTPPort:      server.port(),
+				Security:      tt.security,
+				AuthMechanism: tt.auth,
+			})
+			if err != nil {
+				t.Fatalf("NewSMTPMailer: %v", err)
+			}
+			defer m.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client, _, err := m.dial(ctx)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("dial: %v", err)
+				}
+				_ = client.Quit()
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				_ = client.Quit()
+				t.Fatalf("dial error = %v, want %q", err, tt.wantErr)
+			}
+
+			server.idle(t)
+			commands, _, _, _ := server.stats()
+			for _, verb := range tt.wantCommands {
+				if !slices.Contains(commands, verb) {
+					t.Errorf("commands %v lack %s", commands, verb)
+				}
+			}
+			for _, verb := range tt.avoidCommands {
+				if slices.Contains(commands, verb) {
+					t.Errorf("commands %v contain %s", commands, verb)
+				}
+			}
+
+			if tt.auth == AuthLogin && slices.Contains(tt.wantCommands, "AUTH") {
+				server.mx.Lock()
+				credentials := slices.Clone(server.credentials)
+				server.mx.Unlock()
+				if !slices.Equal(credentials, []string{"user:secret"}) {
+					t.Errorf("credentials = %v, want [user:secret]", credentials)
+				}
+			}
+		})
+	}
+}
+
+func TestNewAuth(t *testing.T) {
+	tests := []struct {
+		mechanism string
+		wantStart string
+		wantNil   bool
+		wantErr   error
+	}{
+		{mechanism: "", wantStart: "PLAIN"},
+		{mechanism: "plain", wantStart: "PLAIN"},
+		{mechanism: "LOGIN", wantStart: "LOGIN"},
+		{mechanism: "cram-md5", wantStart: "CRAM-MD5"},
+		{mechanism: "none", wantNil: true},
+		{mechanism: "xoauth2", wantErr: ErrUnknownAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mechanism, func(t *testing.T) {
+			auth, err := newAuth(tt.mechanism, "user", "secret", "mail.example.com")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("newAuth error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tt.wantNil {
+				if auth != nil {
+					t.Errorf("newAuth = %T, want nil", auth)
+				}
+				return
+			}
+
+			proto, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com", TLS: true})
+			if err != nil || proto != tt.wantStart {
+				t.Errorf("Start = %q, %v, want %q", proto, err, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestLoginAuthStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		server  smtp.ServerInfo
+		wantErr bool
+	}{
+		{name: "TLS", host: "mail.example.com", server: smtp.ServerInfo{Name: "mail.example.com", TLS: true}},
+		{name: "plaintext to localhost", host: "localhost", server: smtp.ServerInfo{Name: "localhost"}},
+		{name: "plaintext to loopback IP", host: "::1", server: smtp.ServerInfo{Name: "::1"}},
+		{name: "plaintext to remote host", host: "mail.example.com", server: smtp.ServerInfo{Name: "mail.example.com"}, wantErr: true},
+		{name: "other host", host: "mail.example.com", server: smtp.ServerInfo{Name: "evil.example.com", TLS: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &loginAuth{username: "user", password: "secret", host: tt.host}
+
+			proto, initial, err := auth.Start(&tt.server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Start error = %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil && (proto != "LOGIN" || initial != nil) {
+				t.Errorf("Start = %q, %q, want LOGIN without initial response", proto, initial)
+			}
+		})
+	}
+}
+
+func TestLoginAuthNext(t *testing.T) {
+	auth := &loginAuth{username: "user", password: "secret", host: "mail.example.com"}
+
+	tests := []struct {
+		name       string
+		fromServer string
+		more       bool
+		want       string
+		wantErr    bool
+	}{
+		{name: "username", fromServer: "Username:", more: true, want: "user"},
+		{name: "password", fromServer: "Password:", more: true, want: "secret"},
+		{name: "lowercase with spaces", fromServer: " username: ", more: true, want: "user"},
+		{name: "done", fromServer: "2.7.0 Authentication successful", more: false},
+		{name: "unexpected challenge", fromServer: "Token:", more: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := auth.Next([]byte(tt.fromServer), tt.more)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Next error = %v, want error %t", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Next = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
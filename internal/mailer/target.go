@@ -12,6 +12,8 @@ type TargetStore interface {
 	GetSubscribed(ctx context.Context) ([]models.Subscription, error)
 }
 
+// TargetManager keeps the active subscriptions grouped by frequency.
+// Subscriptions are identified by ID, so one email may have several.
 type TargetManager struct {
 	mx      sync.RWMutex
 	targets map[string][]models.Subscription
@@ -29,7 +31,9 @@ func (m *TargetManager) LoadTargets(ctx context.Context, store TargetStore) erro
 		targets[sub.Frequency] = append(targets[sub.Frequency], sub)
 	}
 
+	m.mx.Lock()
 	m.targets = targets
+	m.mx.Unlock()
 
 	return nil
 }
@@ -44,28 +48,34 @@ func (m *TargetManager) GetTargets(subscriptionType string) []models.Subscriptio
 	return copied
 }
 
+// AddTarget adds the subscription or replaces its previous version,
+// which may have had another frequency.
 func (m *TargetManager) AddTarget(sub models.Subscription) {
 	m.mx.Lock()
 	defer m.mx.Unlock()
 
-	for _, existing := range m.targets[sub.Frequency] {
-		if existing.Email == sub.Email {
-			return
-		}
+	m.remove(sub.ID)
+	if m.targets == nil {
+		m.targets = make(map[string][]models.Subscription)
 	}
 	m.targets[sub.Frequency] = append(m.targets[sub.Frequency], sub)
 }
 
-func (m *TargetManager) RemoveTarget(email string, frequency string) {
+func (m *TargetManager) RemoveTarget(id int64) {
 	m.mx.Lock()
 	defer m.mx.Unlock()
 
-	subs := m.targets[frequency]
-	for i, sub := range subs {
-		if sub.Email == email {
-			subs[i] = subs[len(subs)-1]
-			m.targets[frequency] = subs[:len(subs)-1]
-			return
+	m.remove(id)
+}
+
+func (m *TargetManager) remove(id int64) {
+	for frequency, subs := range m.targets {
+		for i, sub := range subs {
+			if sub.ID == id {
+				subs[i] = subs[len(subs)-1]
+				m.targets[frequency] = subs[:len(subs)-1]
+				return
+			}
 		}
 	}
 }
@@ -0,0 +1,177 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"weather/internal/i18n"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TemplateConfirmation = "confirmation"
+	TemplateForecast     = "forecast"
+	TemplateUnsubscribe  = "unsubscribe"
+	TemplateAlert        = "alert"
+	TemplateReminder     = "reminder"
+	TemplateManage       = "manage"
+
+	layoutTemplate = "layout.html.tmpl"
+)
+
+var templateNames = []string{
+	TemplateConfirmation,
+	TemplateForecast,
+	TemplateUnsubscribe,
+	TemplateAlert,
+	TemplateReminder,
+	TemplateManage,
+}
+
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Renderer renders emails from the embedded templates. Every file
+// found in the override directory replaces the embedded one with the same name.
+// Translations live next to the default templates as name.<language>.txt.tmpl
+// and name.<language>.html.tmpl.
+type Renderer struct {
+	templates map[string]emailTemplate
+}
+
+func NewRenderer(overrideDir string) (*Renderer, error) {
+	read := func(name string) (string, error) {
+		if overrideDir != "" {
+			content, err := os.ReadFile(filepath.Join(overrideDir, name))
+			if err == nil {
+				return string(content), nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", errors.Wrapf(err, "unable to read template %s", name)
+			}
+		}
+
+		content, err := defaultTemplates.ReadFile("templates/" + name)
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to read embedded template %s", name)
+		}
+
+		return string(content), nil
+	}
+
+	// readLocalized prefers name.<language>.<ext> and falls back to
+	// the default language template name.<ext>.
+	readLocalized := func(name, language, ext string) (string, error) {
+		if language != i18n.Default {
+			content, err := read(name + "." + language + ext)
+			if !errors.Is(err, fs.ErrNotExist) {
+				return content, err
+			}
+		}
+
+		return read(name + ext)
+	}
+
+	layout, err := read(layoutTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Renderer{templates: make(map[string]emailTemplate)}
+	for _, language := range i18n.Languages() {
+		funcs := templateFuncs(i18n.Get(language))
+
+		for _, name := range templateNames {
+			text, err := readLocalized(name, language, ".txt.tmpl")
+			if err != nil {
+				return nil, err
+			}
+			html, err := readLocalized(name, language, ".html.tmpl")
+			if err != nil {
+				return nil, err
+			}
+
+			textTmpl, err := texttemplate.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to parse %s text template (%s)", name, language)
+			}
+			if textTmpl.Lookup("subject") == nil {
+				return nil, errors.Errorf("%s text template (%s) doesn't define a subject", name, language)
+			}
+
+			htmlTmpl, err := htmltemplate.New(name).Funcs(funcs).Option("missingkey=error").Parse(layout)
+			if err == nil {
+				htmlTmpl, err = htmlTmpl.Parse(html)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to parse %s html template (%s)", name, language)
+			}
+
+			r.templates[templateKey(name, language)] = emailTemplate{text: textTmpl, html: htmlTmpl}
+		}
+	}
+
+	return r, nil
+}
+
+func templateKey(name, language string) string {
+	return name + "." + language
+}
+
+// templateFuncs are available in every template and format values
+// according to the language of the email.
+func templateFuncs(locale *i18n.Locale) map[string]any {
+	return map[string]any{
+		"lang":        func() string { return locale.Language },
+		"date":        locale.Date,
+		"number":      locale.Number,
+		"decimal":     locale.Decimal,
+		"temperature": locale.Temperature,
+		"frequency":   locale.Frequency,
+		"condition":   locale.Condition,
+	}
+}
+
+// Render produces the subject, plain text and HTML bodies of the named email
+// in the language. Unsupported languages are rendered in the default one.
+func (r *Renderer) Render(name, language string, data any) (subject, text, html string, err error) {
+	if !i18n.Supported(language) {
+		language = i18n.Default
+	}
+
+	tmpl, ok := r.templates[templateKey(name, language)]
+	if !ok {
+		return "", "", "", errors.Errorf("unknown email template %s", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return "", "", "", errors.Wrapf(err, "unable to render %s subject", name)
+	}
+	subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := tmpl.text.Execute(&buf, data); err != nil {
+		return "", "", "", errors.Wrapf(err, "unable to render %s text", name)
+	}
+	text = buf.String()
+
+	buf.Reset()
+	if err := tmpl.html.ExecuteTemplate(&buf, "layout", data); err != nil {
+		return "", "", "", errors.Wrapf(err, "unable to render %s html", name)
+	}
+	html = buf.String()
+
+	return subject, text, html, nil
+}
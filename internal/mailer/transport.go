@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"weather/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	TransportSMTP = "smtp"
+	TransportHTTP = "http"
+	TransportFile = "file"
+	TransportLog  = "log"
+	// TransportSandbox keeps emails in memory for the dev mailbox.
+	TransportSandbox = "sandbox"
+)
+
+var (
+	ErrUnknownTransport = errors.New("unknown mail transport")
+	// ErrSandboxInRelease keeps release mode, where the dev mailbox isn't
+	// mounted, from dropping every email into memory.
+	ErrSandboxInRelease = errors.New("sandbox mail transport can't be used in release mode")
+)
+
+// Email is a message with a plain text Body and an optional HTML alternative.
+// Headers are added to the standard ones, e.g. List-Unsubscribe.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+	HTML    string
+	Headers map[string]string
+}
+
+// PermanentError marks a delivery failure that retrying won't fix,
+// e.g. a rejected recipient.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// Transport delivers a single email. Implementations must be safe
+// for concurrent use.
+type Transport interface {
+	Send(ctx context.Context, email Email) error
+	Close() error
+}
+
+func sender(smtpConfig config.SMTPConfig) mail.Address {
+	address := smtpConfig.FromAddress
+	if address == "" {
+		address = smtpConfig.SMTPUser
+	}
+
+	return mail.Address{Name: smtpConfig.FromName, Address: address}
+}
+
+// NewTransport creates the transport selected by config.Kind.
+// Every transport sends from the SMTP From address. The sandbox is
+// refused in gin's release mode.
+func NewTransport(transportConfig config.MailTransportConfig, smtpConfig config.SMTPConfig) (Transport, error) {
+	switch strings.ToLower(transportConfig.Kind) {
+	case TransportSMTP, "":
+		return NewSMTPMailer(smtpConfig)
+	case TransportHTTP:
+		return NewHTTPTransport(transportConfig.HTTP, sender(smtpConfig))
+	case TransportFile:
+		return NewFileTransport(transportConfig.File, sender(smtpConfig))
+	case TransportLog:
+		return NewLogTransport(sender(smtpConfig)), nil
+	case TransportSandbox:
+		if gin.Mode() == gin.ReleaseMode {
+			return nil, ErrSandboxInRelease
+		}
+		return NewSandboxTransport(transportConfig.SandboxCapacity, sender(smtpConfig)), nil
+	default:
+		return nil, errors.Wrap(ErrUnknownTransport, transportConfig.Kind)
+	}
+}
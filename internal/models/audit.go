@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+const (
+	EventSubscribed   = "subscribed"
+	EventConfirmed    = "confirmed"
+	EventUpdated      = "updated"
+	EventPaused       = "paused"
+	EventResumed      = "resumed"
+	EventUnsubscribed = "unsubscribed"
+	EventCancelled    = "cancelled"
+	EventExported     = "exported"
+	EventImported     = "imported"
+)
+
+type AuditEvent struct {
+	SubscriptionID int64     `json:"subscription_id,omitempty" db:"subscription_id"`
+	Event          string    `json:"event" db:"event"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
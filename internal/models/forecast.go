@@ -1,7 +1,10 @@
 package models
 
 type Forecast struct {
-	Email   string
-	City    string
-	Weather Weather
+	Email            string
+	City             string
+	Language         string
+	Units            string
+	UnsubscribeToken string
+	Weather          Weather
 }
@@ -0,0 +1,26 @@
+package models
+
+const (
+	OutboxPending = "pending"
+	OutboxSending = "sending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+type OutboxMessage struct {
+	ID          int64             `json:"id" db:"id"`
+	Recipient   string            `json:"recipient" db:"recipient"`
+	Subject     string            `json:"subject" db:"subject"`
+	Body        string            `json:"body" db:"body"`
+	HTMLBody    string            `json:"html_body" db:"html_body"`
+	Headers     map[string]string `json:"headers" db:"headers"`
+	Attempts    int               `json:"attempts" db:"attempts"`
+	MaxAttempts int               `json:"max_attempts" db:"max_attempts"`
+}
+
+type OutboxStats struct {
+	Pending int `json:"pending"`
+	Sending int `json:"sending"`
+	Sent    int `json:"sent"`
+	Dead    int `json:"dead"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Delivery is an email sent or queued for a subscriber.
+type Delivery struct {
+	Subject   string    `json:"subject" db:"subject"`
+	Status    string    `json:"status" db:"status"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	SentAt    time.Time `json:"sent_at,omitzero" db:"sent_at"`
+}
+
+// SubscriberData is everything stored about an email address.
+type SubscriberData struct {
+	Email         string         `json:"email"`
+	ExportedAt    time.Time      `json:"exported_at"`
+	Subscriptions []Subscription `json:"subscriptions"`
+	Deliveries    []Delivery     `json:"deliveries"`
+	AuditEvents   []AuditEvent   `json:"audit_events"`
+}
+
+// Erasure reports what was removed for an email address.
+type Erasure struct {
+	SubscriptionIDs []int64 `json:"subscription_ids"`
+	OutboxMessages  int64   `json:"outbox_messages"`
+	AuditEvents     int64   `json:"audit_events"`
+}
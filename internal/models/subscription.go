@@ -1,14 +1,83 @@
 package models
 
+import (
+	"slices"
+	"time"
+)
+
 const (
 	Hourly = "hourly"
 	Daily  = "daily"
 )
 
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+const (
+	StatusPending      = "pending"
+	StatusActive       = "active"
+	StatusPaused       = "paused"
+	StatusUnsubscribed = "unsubscribed"
+	StatusBounced      = "bounced"
+)
+
+// statusTransitions lists the statuses a subscription may move to.
+// Pending subscriptions that are never confirmed are deleted instead.
+var statusTransitions = map[string][]string{
+	StatusPending:      {StatusActive},
+	StatusActive:       {StatusPaused, StatusUnsubscribed, StatusBounced},
+	StatusPaused:       {StatusActive, StatusUnsubscribed, StatusBounced},
+	StatusUnsubscribed: {StatusPending},
+	StatusBounced:      {StatusPending},
+}
+
+func CanTransition(from, to string) bool {
+	return slices.Contains(statusTransitions[from], to)
+}
+
 type Subscription struct {
-	ID        int64  `db:"id"`
+	ID        int64  `json:"id" db:"id"`
 	Email     string `json:"email" db:"email"`
 	City      string `json:"city" db:"city"`
 	Frequency string `json:"frequency" db:"frequency"`
-	Token     string
+	Language  string `json:"language" db:"language"`
+	Units     string `json:"units" db:"units"`
+	Status    string `json:"status" db:"status"`
+
+	// DeliveryHour is the hour of the day daily forecasts are sent at.
+	DeliveryHour int `json:"delivery_hour" db:"delivery_hour"`
+
+	// UnsubscribeSalt derives the unsubscribe token, see token.Signer.
+	UnsubscribeSalt string `json:"-" db:"unsubscribe_salt"`
+
+	CreatedAt             time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at" db:"updated_at"`
+	ConfirmationExpiresAt time.Time `json:"confirmation_expires_at,omitzero" db:"confirmation_expires_at"`
+	ConfirmedAt           time.Time `json:"confirmed_at,omitzero" db:"confirmed_at"`
+	UnsubscribedAt        time.Time `json:"unsubscribed_at,omitzero" db:"unsubscribed_at"`
+
+	// Plain tokens are only known right after they are issued;
+	// the database keeps their hashes.
+	ConfirmToken     string `json:"-"`
+	UnsubscribeToken string `json:"-"`
+}
+
+// SubscriptionFilter narrows subscription listings; empty fields match
+// every subscription.
+type SubscriptionFilter struct {
+	Status    string
+	City      string
+	Frequency string
+}
+
+// SubscriptionChanges lists the preferences a subscriber may change;
+// nil fields are left as they are.
+type SubscriptionChanges struct {
+	City         *string `json:"city"`
+	Frequency    *string `json:"frequency"`
+	Units        *string `json:"units"`
+	Language     *string `json:"language"`
+	DeliveryHour *int    `json:"delivery_hour"`
 }
@@ -5,5 +5,10 @@ import "errors"
 var (
 	ErrorNotFound      = errors.New("resource not found")
 	ErrorAlreadyExists = errors.New("resource already exists")
+	ErrorPaused        = errors.New("subscription is paused")
 	ErrorTokenNotFound = errors.New("token not found")
+	ErrorTokenExpired  = errors.New("token expired")
+
+	ErrorInvalidTransition = errors.New("subscription status doesn't allow this change")
+	ErrorLeaseLost         = errors.New("outbox message was claimed again after its lease expired")
 )
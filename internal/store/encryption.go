@@ -0,0 +1,279 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	joinErr "errors"
+
+	"github.com/pkg/errors"
+)
+
+// ReencryptTimeoutDuration bounds one batch of Reencrypt.
+const ReencryptTimeoutDuration = 30 * time.Second
+
+// EmailCipher encrypts email addresses at rest. The blind index finds
+// and deduplicates rows by address without decrypting them.
+type EmailCipher interface {
+	KeyID() string
+	Encrypt(plaintext string) ([]byte, error)
+	Decrypt(keyID string, ciphertext []byte) (string, error)
+	BlindIndex(value string) string
+}
+
+// sealed is a value encrypted with the current key.
+type sealed struct {
+	hash       string
+	ciphertext []byte
+	keyID      string
+}
+
+func seal(cipher EmailCipher, value string) (sealed, error) {
+	ciphertext, err := cipher.Encrypt(value)
+	if err != nil {
+		return sealed{}, errors.Wrap(err, "failed to encrypt")
+	}
+
+	return sealed{
+		hash:       cipher.BlindIndex(value),
+		ciphertext: ciphertext,
+		keyID:      cipher.KeyID(),
+	}, nil
+}
+
+// open returns the plaintext column of rows written before encryption
+// and decrypts the ciphertext otherwise.
+func open(cipher EmailCipher, plaintext sql.NullString, keyID sql.NullString, ciphertext []byte) (string, error) {
+	if ciphertext == nil {
+		return plaintext.String, nil
+	}
+
+	value, err := cipher.Decrypt(keyID.String, ciphertext)
+	return value, errors.Wrap(err, "failed to decrypt")
+}
+
+type EncryptionStore struct {
+	db     *sql.DB
+	cipher EmailCipher
+}
+
+// Reencrypt encrypts up to limit rows of every table holding emails that
+// are still in plaintext or, when rotating, encrypted with another key
+// than the current one. It returns the number of rows changed, so callers
+// repeat it until nothing is left.
+func (es *EncryptionStore) Reencrypt(ctx context.Context, limit int, rotate bool) (int, error) {
+	total := 0
+	for _, reencrypt := range []func(context.Context, int, bool) (int, error){
+		es.reencryptSubscriptions,
+		es.reencryptOutbox,
+		es.hashAuditEvents,
+	} {
+		changed, err := reencrypt(ctx, limit, rotate)
+		total += changed
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// Remaining counts the rows Reencrypt still has to change, including rows
+// it skipped because another transaction held them.
+func (es *EncryptionStore) Remaining(ctx context.Context, rotate bool) (int, error) {
+	const query = `
+		SELECT
+			(SELECT count(*) FROM weather.subscriptions WHERE email IS NOT NULL OR ($1 AND email_key_id <> $2))
+			+ (SELECT count(*) FROM weather.outbox WHERE recipient IS NOT NULL OR ($1 AND key_id <> $2))
+			+ (SELECT count(*) FROM weather.audit_events WHERE email IS NOT NULL);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, ReencryptTimeoutDuration)
+	defer cancel()
+
+	var remaining int
+	err := es.db.QueryRowContext(ctx, query, rotate, es.cipher.KeyID()).Scan(&remaining)
+	return remaining, errors.Wrap(err, "failed to count rows to encrypt")
+}
+
+func (es *EncryptionStore) reencryptSubscriptions(ctx context.Context, limit int, rotate bool) (int, error) {
+	const (
+		selectQuery = `
+			SELECT id, email, email_key_id, email_ciphertext
+			FROM weather.subscriptions
+			WHERE email IS NOT NULL OR ($1 AND email_key_id <> $2)
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED;
+		`
+		updateQuery = `
+			UPDATE weather.subscriptions
+			SET email = NULL, email_hash = $2, email_ciphertext = $3, email_key_id = $4
+			WHERE id = $1;
+		`
+	)
+
+	return es.batch(ctx, func(ctx context.Context, tx *sql.Tx) (int, error) {
+		type row struct {
+			id         int64
+			email      sql.NullString
+			keyID      sql.NullString
+			ciphertext []byte
+		}
+
+		var rows []row
+		err := collect(ctx, tx, selectQuery, func(r *sql.Rows) error {
+			var rw row
+			err := r.Scan(&rw.id, &rw.email, &rw.keyID, &rw.ciphertext)
+			rows = append(rows, rw)
+			return err
+		}, rotate, es.cipher.KeyID(), limit)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to select subscriptions to encrypt")
+		}
+
+		for _, rw := range rows {
+			email, err := open(es.cipher, rw.email, rw.keyID, rw.ciphertext)
+			if err != nil {
+				return 0, errors.Wrapf(err, "subscription %d", rw.id)
+			}
+
+			s, err := seal(es.cipher, email)
+			if err != nil {
+				return 0, err
+			}
+
+			if _, err := tx.ExecContext(ctx, updateQuery, rw.id, s.hash, s.ciphertext, s.keyID); err != nil {
+				return 0, errors.Wrap(err, "failed to encrypt subscription email")
+			}
+		}
+
+		return len(rows), nil
+	})
+}
+
+func (es *EncryptionStore) reencryptOutbox(ctx context.Context, limit int, rotate bool) (int, error) {
+	const (
+		selectQuery = `
+			SELECT id, key_id, recipient, recipient_ciphertext, body, body_ciphertext, html_body, html_body_ciphertext
+			FROM weather.outbox
+			WHERE recipient IS NOT NULL OR ($1 AND key_id <> $2)
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED;
+		`
+		updateQuery = `
+			UPDATE weather.outbox
+			SET recipient = NULL, body = NULL, html_body = NULL,
+				recipient_hash = $2, recipient_ciphertext = $3, body_ciphertext = $4,
+				html_body_ciphertext = $5, key_id = $6
+			WHERE id = $1;
+		`
+	)
+
+	return es.batch(ctx, func(ctx context.Context, tx *sql.Tx) (int, error) {
+		type row struct {
+			id                               int64
+			keyID, recipient, body, htmlBody sql.NullString
+			recipientCT, bodyCT, htmlBodyCT  []byte
+		}
+
+		var rows []row
+		err := collect(ctx, tx, selectQuery, func(r *sql.Rows) error {
+			var rw row
+			err := r.Scan(&rw.id, &rw.keyID, &rw.recipient, &rw.recipientCT, &rw.body, &rw.bodyCT, &rw.htmlBody, &rw.htmlBodyCT)
+			rows = append(rows, rw)
+			return err
+		}, rotate, es.cipher.KeyID(), limit)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to select outbox messages to encrypt")
+		}
+
+		for _, rw := range rows {
+			msg, err := openOutboxMessage(es.cipher, rw.keyID, rw.recipient, rw.recipientCT, rw.body, rw.bodyCT, rw.htmlBody, rw.htmlBodyCT)
+			if err != nil {
+				return 0, errors.Wrapf(err, "outbox message %d", rw.id)
+			}
+
+			s, err := sealOutboxMessage(es.cipher, msg)
+			if err != nil {
+				return 0, err
+			}
+
+			if _, err := tx.ExecContext(
+				ctx, updateQuery, rw.id,
+				s.recipient.hash, s.recipient.ciphertext, s.body, s.htmlBody, s.recipient.keyID,
+			); err != nil {
+				return 0, errors.Wrap(err, "failed to encrypt outbox message")
+			}
+		}
+
+		return len(rows), nil
+	})
+}
+
+// hashAuditEvents replaces plaintext emails of audit events with their
+// blind index; events are only ever looked up by email.
+func (es *EncryptionStore) hashAuditEvents(ctx context.Context, limit int, _ bool) (int, error) {
+	const (
+		selectQuery = `
+			SELECT id, email
+			FROM weather.audit_events
+			WHERE email IS NOT NULL
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED;
+		`
+		updateQuery = `UPDATE weather.audit_events SET email = NULL, email_hash = $2 WHERE id = $1;`
+	)
+
+	return es.batch(ctx, func(ctx context.Context, tx *sql.Tx) (int, error) {
+		emails := make(map[int64]string)
+		err := collect(ctx, tx, selectQuery, func(r *sql.Rows) error {
+			var (
+				id    int64
+				email string
+			)
+			err := r.Scan(&id, &email)
+			emails[id] = email
+			return err
+		}, limit)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to select audit events to hash")
+		}
+
+		for id, email := range emails {
+			if _, err := tx.ExecContext(ctx, updateQuery, id, es.cipher.BlindIndex(email)); err != nil {
+				return 0, errors.Wrap(err, "failed to hash audit event email")
+			}
+		}
+
+		return len(emails), nil
+	})
+}
+
+// batch runs fn in a transaction committed only if fn succeeds.
+func (es *EncryptionStore) batch(
+	ctx context.Context,
+	fn func(ctx context.Context, tx *sql.Tx) (int, error),
+) (changed int, err error) {
+	ctx, cancel := context.WithTimeout(ctx, ReencryptTimeoutDuration)
+	defer cancel()
+
+	tx, err := es.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	if changed, err = fn(ctx, tx); err != nil {
+		return 0, err
+	}
+
+	return changed, errors.Wrap(tx.Commit(), "failed to commit encryption batch")
+}
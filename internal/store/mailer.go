@@ -11,7 +11,8 @@ import (
 )
 
 type MailerStore struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher EmailCipher
 }
 
 func (ss *MailerStore) GetSubscribed(ctx context.Context) (subs []models.Subscription, err error) {
@@ -19,11 +20,16 @@ func (ss *MailerStore) GetSubscribed(ctx context.Context) (subs []models.Subscri
 		SELECT
 			id,
 			email,
+			email_key_id,
+			email_ciphertext,
 			city,
 			frequency,
-			token
+			language,
+			units,
+			delivery_hour,
+			COALESCE(unsubscribe_salt, '')
 		FROM weather.subscriptions
-		WHERE confirmed = true;
+		WHERE status = 'active';
 	`
 
 	rows, err := ss.db.QueryContext(ctx, query)
@@ -44,16 +50,28 @@ func (ss *MailerStore) GetSubscribed(ctx context.Context) (subs []models.Subscri
 	}()
 
 	for rows.Next() {
-		var s models.Subscription
+		var (
+			s            models.Subscription
+			email, keyID sql.NullString
+			ciphertext   []byte
+		)
 		if err := rows.Scan(
 			&s.ID,
-			&s.Email,
+			&email,
+			&keyID,
+			&ciphertext,
 			&s.City,
 			&s.Frequency,
-			&s.Token,
+			&s.Language,
+			&s.Units,
+			&s.DeliveryHour,
+			&s.UnsubscribeSalt,
 		); err != nil {
 			return nil, errors.Wrap(err, "failed to scan subscription row")
 		}
+		if s.Email, err = open(ss.cipher, email, keyID, ciphertext); err != nil {
+			return nil, errors.Wrapf(err, "subscription %d", s.ID)
+		}
 		subs = append(subs, s)
 	}
 
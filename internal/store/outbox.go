@@ -0,0 +1,435 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	joinErr "errors"
+	"time"
+	"weather/internal/models"
+	"weather/internal/srverrors"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const EnqueueTimeoutDuration = 30 * time.Second
+
+type OutboxStore struct {
+	db     *sql.DB
+	cipher EmailCipher
+}
+
+// sealedOutboxMessage holds the encrypted parts of a message; the recipient,
+// and the bodies that greet it, are encrypted with the same key.
+type sealedOutboxMessage struct {
+	recipient sealed
+	body      []byte
+	htmlBody  []byte
+}
+
+func sealOutboxMessage(cipher EmailCipher, msg models.OutboxMessage) (sealedOutboxMessage, error) {
+	recipient, err := seal(cipher, msg.Recipient)
+	if err != nil {
+		return sealedOutboxMessage{}, err
+	}
+
+	body, err := cipher.Encrypt(msg.Body)
+	if err != nil {
+		return sealedOutboxMessage{}, errors.Wrap(err, "failed to encrypt")
+	}
+
+	htmlBody, err := cipher.Encrypt(msg.HTMLBody)
+	if err != nil {
+		return sealedOutboxMessage{}, errors.Wrap(err, "failed to encrypt")
+	}
+
+	return sealedOutboxMessage{recipient: recipient, body: body, htmlBody: htmlBody}, nil
+}
+
+// openOutboxMessage restores the recipient and bodies of a message stored
+// either in plaintext or encrypted.
+func openOutboxMessage(
+	cipher EmailCipher,
+	keyID sql.NullString,
+	recipient sql.NullString, recipientCiphertext []byte,
+	body sql.NullString, bodyCiphertext []byte,
+	htmlBody sql.NullString, htmlBodyCiphertext []byte,
+) (msg models.OutboxMessage, err error) {
+	if msg.Recipient, err = open(cipher, recipient, keyID, recipientCiphertext); err != nil {
+		return msg, err
+	}
+	if msg.Body, err = open(cipher, body, keyID, bodyCiphertext); err != nil {
+		return msg, err
+	}
+	msg.HTMLBody, err = open(cipher, htmlBody, keyID, htmlBodyCiphertext)
+
+	return msg, err
+}
+
+// Enqueue stores the messages with a single COPY, so a whole mailing
+// is either queued or not.
+func (obs *OutboxStore) Enqueue(ctx context.Context, msgs []models.OutboxMessage) (err error) {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, EnqueueTimeoutDuration)
+	defer cancel()
+
+	tx, err := obs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	if err = copyOutboxMessages(ctx, tx, obs.cipher, msgs); err != nil {
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit outbox messages")
+}
+
+func copyOutboxMessages(ctx context.Context, tx *sql.Tx, cipher EmailCipher, msgs []models.OutboxMessage) (err error) {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema(
+		"weather", "outbox",
+		"recipient_hash", "recipient_ciphertext", "subject", "body_ciphertext", "html_body_ciphertext",
+		"key_id", "headers", "max_attempts",
+	))
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare outbox copy")
+	}
+
+	defer func() {
+		closeErr := stmt.Close()
+		if closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "failed to close statement")
+			if err != nil {
+				err = joinErr.Join(err, closeErr)
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	for _, msg := range msgs {
+		headers, err := marshalHeaders(msg.Headers)
+		if err != nil {
+			return err
+		}
+
+		s, err := sealOutboxMessage(cipher, msg)
+		if err != nil {
+			return err
+		}
+
+		if _, err := stmt.ExecContext(
+			ctx,
+			s.recipient.hash,
+			s.recipient.ciphertext,
+			msg.Subject,
+			s.body,
+			s.htmlBody,
+			s.recipient.keyID,
+			headers,
+			msg.MaxAttempts,
+		); err != nil {
+			return errors.Wrap(err, "failed to copy outbox message")
+		}
+	}
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return errors.Wrap(err, "failed to flush outbox copy")
+	}
+
+	return nil
+}
+
+func marshalHeaders(headers map[string]string) (string, error) {
+	if len(headers) == 0 {
+		return "{}", nil
+	}
+
+	encoded, err := json.Marshal(headers)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal outbox headers")
+	}
+
+	return string(encoded), nil
+}
+
+func insertOutboxMessage(ctx context.Context, tx *sql.Tx, cipher EmailCipher, msg models.OutboxMessage) error {
+	const query = `
+		INSERT INTO weather.outbox (
+			recipient_hash, recipient_ciphertext, subject, body_ciphertext, html_body_ciphertext,
+			key_id, headers, max_attempts
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+
+	headers, err := marshalHeaders(msg.Headers)
+	if err != nil {
+		return err
+	}
+
+	s, err := sealOutboxMessage(cipher, msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		s.recipient.hash,
+		s.recipient.ciphertext,
+		msg.Subject,
+		s.body,
+		s.htmlBody,
+		s.recipient.keyID,
+		headers,
+		msg.MaxAttempts,
+	)
+
+	return errors.Wrap(err, "failed to enqueue outbox message")
+}
+
+// Claim leases up to limit due messages. Messages whose lease has expired,
+// e.g. because the process died mid-send, are claimed again, unless that
+// was their last attempt; those are dead-lettered instead. Every claim
+// counts an attempt, so the attempt identifies the claim when the result
+// is recorded.
+func (obs *OutboxStore) Claim(
+	ctx context.Context,
+	limit int,
+	lease time.Duration,
+) (msgs []models.OutboxMessage, err error) {
+	const query = `
+		WITH expired AS (
+			UPDATE weather.outbox o
+			SET status = 'dead', locked_until = NULL, last_error = 'lease expired on the last attempt', updated_at = now()
+			FROM (
+				SELECT id
+				FROM weather.outbox
+				WHERE status = 'sending' AND locked_until < now() AND attempts >= max_attempts
+				FOR UPDATE SKIP LOCKED
+			) out_of_attempts
+			WHERE o.id = out_of_attempts.id
+		)
+		UPDATE weather.outbox o
+		SET
+			status = 'sending',
+			attempts = o.attempts + 1,
+			locked_until = now() + make_interval(secs => $2),
+			updated_at = now()
+		FROM (
+			SELECT id
+			FROM weather.outbox
+			WHERE (status = 'pending' AND next_attempt_at <= now())
+				OR (status = 'sending' AND locked_until < now() AND attempts < max_attempts)
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		) due
+		WHERE o.id = due.id
+		RETURNING o.id, o.key_id, o.recipient, o.recipient_ciphertext, o.subject, o.body, o.body_ciphertext,
+			o.html_body, o.html_body_ciphertext, o.headers, o.attempts, o.max_attempts;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := obs.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim outbox messages")
+	}
+
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "failed to close rows")
+			if err != nil {
+				err = joinErr.Join(err, closeErr)
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			id, attempts, maxAttempts    int
+			keyID, recipient, body, html sql.NullString
+			recipientCT, bodyCT, htmlCT  []byte
+			subject                      string
+			headers                      []byte
+		)
+		if err := rows.Scan(
+			&id,
+			&keyID,
+			&recipient,
+			&recipientCT,
+			&subject,
+			&body,
+			&bodyCT,
+			&html,
+			&htmlCT,
+			&headers,
+			&attempts,
+			&maxAttempts,
+		); err != nil {
+			return nil, errors.Wrap(err, "failed to scan outbox row")
+		}
+
+		m, err := openOutboxMessage(obs.cipher, keyID, recipient, recipientCT, body, bodyCT, html, htmlCT)
+		if err != nil {
+			return nil, errors.Wrapf(err, "outbox message %d", id)
+		}
+		m.ID, m.Subject, m.Attempts, m.MaxAttempts = int64(id), subject, attempts, maxAttempts
+
+		if err := json.Unmarshal(headers, &m.Headers); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal outbox headers")
+		}
+		msgs = append(msgs, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "row iteration error")
+	}
+
+	return msgs, nil
+}
+
+// exec updates a message claimed with the given attempt. A message still
+// in sending with another attempt was claimed again after the lease
+// expired, so the update is left to the new claim.
+func (obs *OutboxStore) exec(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := obs.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return srverrors.ErrorLeaseLost
+	}
+
+	return nil
+}
+
+func (obs *OutboxStore) MarkSent(ctx context.Context, id int64, attempt int) error {
+	const query = `
+		UPDATE weather.outbox
+		SET status = 'sent', sent_at = now(), locked_until = NULL, last_error = NULL, updated_at = now()
+		WHERE id = $1 AND status = 'sending' AND attempts = $2;
+	`
+
+	return errors.Wrap(obs.exec(ctx, query, id, attempt), "failed to mark outbox message as sent")
+}
+
+func (obs *OutboxStore) MarkFailed(ctx context.Context, id int64, attempt int, reason string, retryAt time.Time) error {
+	const query = `
+		UPDATE weather.outbox
+		SET status = 'pending', next_attempt_at = $4, locked_until = NULL, last_error = $3, updated_at = now()
+		WHERE id = $1 AND status = 'sending' AND attempts = $2;
+	`
+
+	return errors.Wrap(obs.exec(ctx, query, id, attempt, reason, retryAt), "failed to reschedule outbox message")
+}
+
+func (obs *OutboxStore) MarkDead(ctx context.Context, id int64, attempt int, reason string) error {
+	const query = `
+		UPDATE weather.outbox
+		SET status = 'dead', locked_until = NULL, last_error = $3, updated_at = now()
+		WHERE id = $1 AND status = 'sending' AND attempts = $2;
+	`
+
+	return errors.Wrap(obs.exec(ctx, query, id, attempt, reason), "failed to dead-letter outbox message")
+}
+
+// PurgeSent deletes messages sent more than olderThan ago. Dead messages
+// are kept for inspection.
+func (obs *OutboxStore) PurgeSent(ctx context.Context, olderThan time.Duration) (int64, error) {
+	const query = `
+		DELETE FROM weather.outbox
+		WHERE status = 'sent' AND sent_at < now() - make_interval(secs => $1);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := obs.db.ExecContext(ctx, query, olderThan.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge sent outbox messages")
+	}
+
+	purged, err := res.RowsAffected()
+	return purged, errors.Wrap(err, "failed to count purged outbox messages")
+}
+
+func (obs *OutboxStore) Stats(ctx context.Context) (stats models.OutboxStats, err error) {
+	const query = `
+		SELECT status, count(*)
+		FROM weather.outbox
+		GROUP BY status;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := obs.db.QueryContext(ctx, query)
+	if err != nil {
+		return models.OutboxStats{}, errors.Wrap(err, "failed to count outbox messages")
+	}
+
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "failed to close rows")
+			if err != nil {
+				err = joinErr.Join(err, closeErr)
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	for rows.Next() {
+		var (
+			status string
+			count  int
+		)
+		if err := rows.Scan(&status, &count); err != nil {
+			return models.OutboxStats{}, errors.Wrap(err, "failed to scan outbox count")
+		}
+
+		switch status {
+		case models.OutboxPending:
+			stats.Pending = count
+		case models.OutboxSending:
+			stats.Sending = count
+		case models.OutboxSent:
+			stats.Sent = count
+		case models.OutboxDead:
+			stats.Dead = count
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.OutboxStats{}, errors.Wrap(err, "row iteration error")
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"weather/internal/models"
+
+	joinErr "errors"
+
+	"github.com/pkg/errors"
+)
+
+// PrivacyTimeoutDuration bounds exports and erasures, which touch every
+// table holding the email.
+const PrivacyTimeoutDuration = 10 * time.Second
+
+type PrivacyStore struct {
+	db     *sql.DB
+	cipher EmailCipher
+}
+
+// Export collects everything stored about the email and records the export.
+func (ps *PrivacyStore) Export(ctx context.Context, email string) (data models.SubscriberData, err error) {
+	const (
+		subscriptionsQuery = `
+			SELECT ` + subscriptionColumns + `
+			FROM weather.subscriptions
+			WHERE email_hash = $1
+			ORDER BY created_at, id;
+		`
+		deliveriesQuery = `
+			SELECT subject, status, created_at, sent_at
+			FROM weather.outbox
+			WHERE recipient_hash = $1
+			ORDER BY created_at, id;
+		`
+		auditQuery = `
+			SELECT COALESCE(subscription_id, 0), event, created_at
+			FROM weather.audit_events
+			WHERE email_hash = $1
+			ORDER BY created_at, id;
+		`
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, PrivacyTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return data, errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	emailHash := ps.cipher.BlindIndex(email)
+	if err = insertAuditEvent(ctx, tx, emailHash, 0, models.EventExported); err != nil {
+		return data, err
+	}
+
+	data = models.SubscriberData{
+		Email:         email,
+		ExportedAt:    time.Now(),
+		Subscriptions: []models.Subscription{},
+		Deliveries:    []models.Delivery{},
+		AuditEvents:   []models.AuditEvent{},
+	}
+
+	err = collect(ctx, tx, subscriptionsQuery, func(rows *sql.Rows) error {
+		sub, err := scanSubscription(rows, ps.cipher)
+		data.Subscriptions = append(data.Subscriptions, sub)
+		return err
+	}, emailHash)
+	if err != nil {
+		return data, errors.Wrap(err, "failed to export subscriptions")
+	}
+
+	err = collect(ctx, tx, deliveriesQuery, func(rows *sql.Rows) error {
+		var (
+			delivery models.Delivery
+			sentAt   sql.NullTime
+		)
+		err := rows.Scan(&delivery.Subject, &delivery.Status, &delivery.CreatedAt, &sentAt)
+		delivery.SentAt = sentAt.Time
+		data.Deliveries = append(data.Deliveries, delivery)
+		return err
+	}, emailHash)
+	if err != nil {
+		return data, errors.Wrap(err, "failed to export deliveries")
+	}
+
+	err = collect(ctx, tx, auditQuery, func(rows *sql.Rows) error {
+		var event models.AuditEvent
+		err := rows.Scan(&event.SubscriptionID, &event.Event, &event.CreatedAt)
+		data.AuditEvents = append(data.AuditEvents, event)
+		return err
+	}, emailHash)
+	if err != nil {
+		return data, errors.Wrap(err, "failed to export audit events")
+	}
+
+	return data, errors.Wrap(tx.Commit(), "failed to commit export")
+}
+
+// Erase permanently deletes the subscriptions, the queued and sent emails,
+// the audit events and the session row of the email. Without the row every
+// session of the email is revoked.
+func (ps *PrivacyStore) Erase(ctx context.Context, email string) (erasure models.Erasure, err error) {
+	const (
+		subscriptionsQuery = `DELETE FROM weather.subscriptions WHERE email_hash = $1 RETURNING id;`
+		outboxQuery        = `DELETE FROM weather.outbox WHERE recipient_hash = $1;`
+		auditQuery         = `DELETE FROM weather.audit_events WHERE email_hash = $1;`
+		sessionQuery       = `DELETE FROM weather.manage_sessions WHERE email_hash = $1;`
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, PrivacyTimeoutDuration)
+	defer cancel()
+
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return erasure, errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	emailHash := ps.cipher.BlindIndex(email)
+
+	erasure.SubscriptionIDs = []int64{}
+	err = collect(ctx, tx, subscriptionsQuery, func(rows *sql.Rows) error {
+		var id int64
+		err := rows.Scan(&id)
+		erasure.SubscriptionIDs = append(erasure.SubscriptionIDs, id)
+		return err
+	}, emailHash)
+	if err != nil {
+		return erasure, errors.Wrap(err, "failed to erase subscriptions")
+	}
+
+	if erasure.OutboxMessages, err = execCount(ctx, tx, outboxQuery, emailHash); err != nil {
+		return erasure, errors.Wrap(err, "failed to erase outbox messages")
+	}
+
+	if erasure.AuditEvents, err = execCount(ctx, tx, auditQuery, emailHash); err != nil {
+		return erasure, errors.Wrap(err, "failed to erase audit events")
+	}
+
+	if _, err = tx.ExecContext(ctx, sessionQuery, emailHash); err != nil {
+		return erasure, errors.Wrap(err, "failed to erase sessions")
+	}
+
+	return erasure, errors.Wrap(tx.Commit(), "failed to commit erasure")
+}
+
+// collect calls scan for every row of the query.
+func collect(ctx context.Context, tx *sql.Tx, query string, scan func(rows *sql.Rows) error, args ...any) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return joinErr.Join(err, rows.Close())
+		}
+	}
+
+	return joinErr.Join(rows.Err(), rows.Close())
+}
+
+func execCount(ctx context.Context, tx *sql.Tx, query string, arg any) (int64, error) {
+	res, err := tx.ExecContext(ctx, query, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"weather/internal/srverrors"
+
+	"github.com/pkg/errors"
+)
+
+// SessionStore keeps what management sessions need server-side: the
+// generation revoking older sessions and when a login link was last sent.
+// It also throttles confirmation resends, which are keyed by email too.
+type SessionStore struct {
+	db     *sql.DB
+	cipher EmailCipher
+}
+
+// Start returns the generation a new session of the email is issued with
+// and keeps the row from being purged while the session lives.
+func (ss *SessionStore) Start(ctx context.Context, email string) (int, error) {
+	const query = `
+		INSERT INTO weather.manage_sessions (email_hash)
+		VALUES ($1)
+		ON CONFLICT (email_hash) DO UPDATE SET updated_at = now()
+		RETURNING generation;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var generation int
+	err := ss.db.QueryRowContext(ctx, query, ss.cipher.BlindIndex(email)).Scan(&generation)
+	return generation, errors.Wrap(err, "failed to start session")
+}
+
+// Generation returns the current session generation of the email; sessions
+// issued with an older one are revoked. Start writes the row and the
+// janitor keeps it while sessions live, so a missing row means the email
+// was erased and srverrors.ErrorNotFound is returned.
+func (ss *SessionStore) Generation(ctx context.Context, email string) (int, error) {
+	const query = `SELECT generation FROM weather.manage_sessions WHERE email_hash = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var generation int
+	err := ss.db.QueryRowContext(ctx, query, ss.cipher.BlindIndex(email)).Scan(&generation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, srverrors.ErrorNotFound
+	}
+
+	return generation, errors.Wrap(err, "failed to get session generation")
+}
+
+// Revoke bumps the session generation, ending every session of the email.
+func (ss *SessionStore) Revoke(ctx context.Context, email string) error {
+	const query = `
+		INSERT INTO weather.manage_sessions (email_hash, generation)
+		VALUES ($1, 1)
+		ON CONFLICT (email_hash) DO UPDATE SET
+			generation = weather.manage_sessions.generation + 1,
+			updated_at = now();
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := ss.db.ExecContext(ctx, query, ss.cipher.BlindIndex(email))
+	return errors.Wrap(err, "failed to revoke sessions")
+}
+
+// AllowLinkRequest records a login link request unless one was recorded
+// within the interval, and reports whether it was recorded.
+func (ss *SessionStore) AllowLinkRequest(ctx context.Context, email string, interval time.Duration) (bool, error) {
+	allowed, err := ss.allowRequest(ctx, "link_requested_at", email, interval)
+	return allowed, errors.Wrap(err, "failed to record login link request")
+}
+
+// AllowConfirmationRequest records a request to resend a confirmation
+// email unless one was recorded within the interval, and reports whether
+// it was recorded.
+func (ss *SessionStore) AllowConfirmationRequest(ctx context.Context, email string, interval time.Duration) (bool, error) {
+	allowed, err := ss.allowRequest(ctx, "confirmation_requested_at", email, interval)
+	return allowed, errors.Wrap(err, "failed to record confirmation request")
+}
+
+// allowRequest sets the timestamp column to now unless it is within the
+// interval.
+func (ss *SessionStore) allowRequest(ctx context.Context, column, email string, interval time.Duration) (bool, error) {
+	query := `
+		INSERT INTO weather.manage_sessions (email_hash, ` + column + `)
+		VALUES ($1, now())
+		ON CONFLICT (email_hash) DO UPDATE SET
+			` + column + ` = now(),
+			updated_at = now()
+		WHERE weather.manage_sessions.` + column + ` IS NULL
+			OR weather.manage_sessions.` + column + ` <= now() - make_interval(secs => $2)
+		RETURNING true;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var allowed bool
+	err := ss.db.QueryRowContext(ctx, query, ss.cipher.BlindIndex(email), interval.Seconds()).Scan(&allowed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return allowed, err
+}
+
+// PurgeStale deletes rows untouched for longer than olderThan, which must
+// exceed the session lifetime and the request intervals: every
+// session issued or revoked through them has expired by then.
+func (ss *SessionStore) PurgeStale(ctx context.Context, olderThan time.Duration) (int64, error) {
+	const query = `
+		DELETE FROM weather.manage_sessions
+		WHERE updated_at < now() - make_interval(secs => $1);
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ss.db.ExecContext(ctx, query, olderThan.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge stale sessions")
+	}
+
+	purged, err := res.RowsAffected()
+	return purged, errors.Wrap(err, "failed to count purged sessions")
+}
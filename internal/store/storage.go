@@ -9,20 +9,71 @@ import (
 
 const QueryTimeoutDuration = 1 * time.Second
 
+// ListTimeoutDuration bounds queries over all subscriptions, run by operators.
+const ListTimeoutDuration = 30 * time.Second
+
 type Storage struct {
 	Subscription interface {
-		Create(context.Context, *models.Subscription) error
+		Create(ctx context.Context, sub *models.Subscription, confirmation models.OutboxMessage) error
+		RenewConfirmToken(
+			ctx context.Context,
+			email, city, frequency, confirmToken string,
+			expiresAt time.Time,
+			confirmation func(models.Subscription) (models.OutboxMessage, error),
+		) error
 		Confirm(ctx context.Context, token string) (models.Subscription, error)
 		Unsubscribe(ctx context.Context, token string) (models.Subscription, error)
+		Cancel(ctx context.Context, token string) (models.Subscription, error)
+		Pause(ctx context.Context, token string) (models.Subscription, error)
+		Resume(ctx context.Context, token string) (models.Subscription, error)
+		GetByToken(ctx context.Context, token string) (models.Subscription, error)
+		Update(ctx context.Context, token string, changes models.SubscriptionChanges) (models.Subscription, error)
+		ListByEmail(ctx context.Context, email string) ([]models.Subscription, error)
+		UnsubscribeByEmail(ctx context.Context, email string, ids []int64) ([]models.Subscription, error)
+		List(ctx context.Context, filter models.SubscriptionFilter) ([]models.Subscription, error)
+		Import(ctx context.Context, subs []models.Subscription) ([]models.Subscription, error)
+		AssignUnsubscribeSalts(ctx context.Context, unsubscribeToken func(salt string) string) (int, error)
+		PurgeExpired(ctx context.Context) (int64, error)
+		GetUnreminded(ctx context.Context, within time.Duration, limit int) ([]models.Subscription, error)
+		MarkReminded(ctx context.Context, sub models.Subscription, reminder models.OutboxMessage) error
 	}
 	Mailer interface {
 		GetSubscribed(ctx context.Context) ([]models.Subscription, error)
 	}
+	Privacy interface {
+		Export(ctx context.Context, email string) (models.SubscriberData, error)
+		Erase(ctx context.Context, email string) (models.Erasure, error)
+	}
+	Outbox interface {
+		Enqueue(ctx context.Context, msgs []models.OutboxMessage) error
+		Claim(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxMessage, error)
+		MarkSent(ctx context.Context, id int64, attempt int) error
+		MarkFailed(ctx context.Context, id int64, attempt int, reason string, retryAt time.Time) error
+		MarkDead(ctx context.Context, id int64, attempt int, reason string) error
+		Stats(ctx context.Context) (models.OutboxStats, error)
+		PurgeSent(ctx context.Context, olderThan time.Duration) (int64, error)
+	}
+	Session interface {
+		Start(ctx context.Context, email string) (int, error)
+		Generation(ctx context.Context, email string) (int, error)
+		Revoke(ctx context.Context, email string) error
+		AllowLinkRequest(ctx context.Context, email string, interval time.Duration) (bool, error)
+		AllowConfirmationRequest(ctx context.Context, email string, interval time.Duration) (bool, error)
+		PurgeStale(ctx context.Context, olderThan time.Duration) (int64, error)
+	}
+	Encryption interface {
+		Reencrypt(ctx context.Context, limit int, rotate bool) (int, error)
+		Remaining(ctx context.Context, rotate bool) (int, error)
+	}
 }
 
-func NewStorage(db *sql.DB) Storage {
+func NewStorage(db *sql.DB, cipher EmailCipher) Storage {
 	return Storage{
-		Subscription: &SubscriptionStore{db},
-		Mailer:       &MailerStore{db},
+		Subscription: &SubscriptionStore{db, cipher},
+		Mailer:       &MailerStore{db, cipher},
+		Privacy:      &PrivacyStore{db, cipher},
+		Outbox:       &OutboxStore{db, cipher},
+		Session:      &SessionStore{db, cipher},
+		Encryption:   &EncryptionStore{db, cipher},
 	}
 }
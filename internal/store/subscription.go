@@ -3,8 +3,13 @@ package store
 import (
 	"context"
 	"database/sql"
+	joinErr "errors"
+	"slices"
+	"strings"
+	"time"
 	"weather/internal/models"
 	"weather/internal/srverrors"
+	"weather/internal/token"
 
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
@@ -12,34 +17,167 @@ import (
 
 const (
 	pgAlreadyExistsCode       = "23505"
-	pgAlreadyExistsConstraint = "subscriptions_email_key"
+	pgAlreadyExistsConstraint = "subscriptions_email_hash_city_frequency_key"
 )
 
+// subscriptionColumns are returned by every query that yields a subscription
+// and are read with scanSubscription, which decrypts the email.
+const subscriptionColumns = `
+	id, email, email_key_id, email_ciphertext, city, frequency, language, units, delivery_hour, status, COALESCE(unsubscribe_salt, ''),
+	created_at, updated_at, confirmation_expires_at, confirmed_at, unsubscribed_at
+`
+
+// legacyTokenMatch accepts the deterministic tokens issued before tokens
+// were randomized, until their grace period ends. Old emails only carry
+// confirm and unsubscribe links, so nothing else accepts them.
+const legacyTokenMatch = `(legacy_token_hash = $1 AND legacy_token_expires_at > now())`
+
+// confirmTokenColumns hold the current confirmation token and the one
+// replaced by a reminder, which stays valid until the subscription expires.
+var confirmTokenColumns = []string{"confirm_token_hash", "previous_confirm_token_hash"}
+
+// tokenMatch matches the token hash in $1 against any of columns, and also
+// against the legacy token when legacy is set.
+func tokenMatch(legacy bool, columns ...string) string {
+	conditions := make([]string, 0, len(columns)+1)
+	for _, column := range columns {
+		conditions = append(conditions, column+` = $1`)
+	}
+	if legacy {
+		conditions = append(conditions, legacyTokenMatch)
+	}
+
+	return `(` + strings.Join(conditions, ` OR `) + `)`
+}
+
+// withAudit turns a statement modifying subscriptions into a query that
+// records the event for every modified row and returns subscriptionColumns.
+// The event must be one of the models.Event constants.
+func withAudit(modify, event string) string {
+	return `
+		WITH changed AS (` + modify + ` RETURNING *),
+		audit AS (
+			INSERT INTO weather.audit_events (email_hash, subscription_id, event)
+			SELECT email_hash, id, '` + event + `' FROM changed
+		)
+		SELECT ` + subscriptionColumns + ` FROM changed;
+	`
+}
+
+// insertAuditEvent records an event in a transaction. Events are stored
+// with the blind index of the email. Events about the email as a whole
+// have no subscription ID.
+func insertAuditEvent(ctx context.Context, tx *sql.Tx, emailHash string, subscriptionID int64, event string) error {
+	const query = `
+		INSERT INTO weather.audit_events (email_hash, subscription_id, event)
+		VALUES ($1, $2, $3);
+	`
+
+	id := sql.NullInt64{Int64: subscriptionID, Valid: subscriptionID != 0}
+	_, err := tx.ExecContext(ctx, query, emailHash, id, event)
+	return errors.Wrap(err, "failed to record audit event")
+}
+
+// restartableStatuses are the statuses a repeated subscribe request
+// restarts double opt-in from. A pending subscription just gets new tokens.
+func restartableStatuses() []string {
+	statuses := []string{models.StatusPending}
+	for _, status := range []string{models.StatusActive, models.StatusPaused, models.StatusUnsubscribed, models.StatusBounced} {
+		if models.CanTransition(status, models.StatusPending) {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses
+}
+
 type SubscriptionStore struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher EmailCipher
 }
 
-func (ss *SubscriptionStore) Create(ctx context.Context, sub *models.Subscription) error {
+// Create stores the subscription together with its confirmation message,
+// so a subscription never exists without a queued confirmation.
+// An existing pending, unsubscribed or bounced subscription for the same
+// email, city and frequency restarts double opt-in with the new tokens and
+// clears its confirmation and unsubscription times; an active one is
+// reported as srverrors.ErrorAlreadyExists and a paused one as
+// srverrors.ErrorPaused.
+func (ss *SubscriptionStore) Create(
+	ctx context.Context,
+	sub *models.Subscription,
+	confirmation models.OutboxMessage,
+) (err error) {
 	query := `
-		INSERT INTO weather.subscriptions (email, city, frequency, token)
-		VALUES ($1, $2, $3, $4)
-		RETURNING weather.subscriptions.id;
+		INSERT INTO weather.subscriptions (
+			email_hash, email_ciphertext, email_key_id, city, frequency, language,
+			confirm_token_hash, unsubscribe_token_hash, unsubscribe_salt,
+			confirmation_expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (email_hash, city, frequency) DO UPDATE SET
+			status = 'pending',
+			email_ciphertext = EXCLUDED.email_ciphertext,
+			email_key_id = EXCLUDED.email_key_id,
+			language = EXCLUDED.language,
+			confirm_token_hash = EXCLUDED.confirm_token_hash,
+			previous_confirm_token_hash = NULL,
+			unsubscribe_token_hash = EXCLUDED.unsubscribe_token_hash,
+			unsubscribe_salt = EXCLUDED.unsubscribe_salt,
+			legacy_token_hash = NULL,
+			legacy_token_expires_at = NULL,
+			confirmation_expires_at = EXCLUDED.confirmation_expires_at,
+			reminder_sent_at = NULL,
+			confirmed_at = NULL,
+			unsubscribed_at = NULL,
+			updated_at = now()
+		WHERE weather.subscriptions.status = ANY($11)
+		RETURNING id, status, created_at, updated_at;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	row := ss.db.QueryRowContext(
+	email, err := seal(ss.cipher, sub.Email)
+	if err != nil {
+		return err
+	}
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	row := tx.QueryRowContext(
 		ctx,
 		query,
-		sub.Email,
+		email.hash,
+		email.ciphertext,
+		email.keyID,
 		sub.City,
 		sub.Frequency,
-		sub.Token,
+		sub.Language,
+		token.Hash(sub.ConfirmToken),
+		token.Hash(sub.UnsubscribeToken),
+		sub.UnsubscribeSalt,
+		sub.ConfirmationExpiresAt,
+		pq.Array(restartableStatuses()),
 	)
 
-	err := row.Scan(&sub.ID)
+	err = row.Scan(&sub.ID, &sub.Status, &sub.CreatedAt, &sub.UpdatedAt)
 	if err != nil {
+		// The conflicting subscription is active or paused.
+		if errors.Is(err, sql.ErrNoRows) {
+			return ss.conflict(ctx, tx, email.hash, sub.City, sub.Frequency)
+		}
 		if pgErr, ok := err.(*pq.Error); ok {
 			if pgErr.Code == pgAlreadyExistsCode && pgErr.Constraint == pgAlreadyExistsConstraint {
 				return srverrors.ErrorAlreadyExists
@@ -48,57 +186,712 @@ func (ss *SubscriptionStore) Create(ctx context.Context, sub *models.Subscriptio
 		return errors.Wrap(err, "failed to create subscription")
 	}
 
+	if err = insertAuditEvent(ctx, tx, email.hash, sub.ID, models.EventSubscribed); err != nil {
+		return err
+	}
+
+	if err = insertOutboxMessage(ctx, tx, ss.cipher, confirmation); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "failed to commit subscription")
+	}
+
 	return nil
 }
 
-func (ss *SubscriptionStore) Confirm(ctx context.Context, token string) (models.Subscription, error) {
+// conflict tells a paused subscription in the way of a new one
+// (srverrors.ErrorPaused) from an active one (srverrors.ErrorAlreadyExists).
+func (ss *SubscriptionStore) conflict(ctx context.Context, tx *sql.Tx, emailHash, city, frequency string) error {
 	const query = `
+		SELECT status
+		FROM weather.subscriptions
+		WHERE email_hash = $1 AND city = $2 AND frequency = $3;
+	`
+
+	var status string
+	if err := tx.QueryRowContext(ctx, query, emailHash, city, frequency).Scan(&status); err != nil {
+		return errors.Wrap(err, "failed to get conflicting subscription")
+	}
+	if status == models.StatusPaused {
+		return srverrors.ErrorPaused
+	}
+
+	return srverrors.ErrorAlreadyExists
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSubscription(row scanner, cipher EmailCipher) (models.Subscription, error) {
+	var (
+		sub                                    models.Subscription
+		email, keyID                           sql.NullString
+		ciphertext                             []byte
+		expiresAt, confirmedAt, unsubscribedAt sql.NullTime
+	)
+	err := row.Scan(
+		&sub.ID,
+		&email,
+		&keyID,
+		&ciphertext,
+		&sub.City,
+		&sub.Frequency,
+		&sub.Language,
+		&sub.Units,
+		&sub.DeliveryHour,
+		&sub.Status,
+		&sub.UnsubscribeSalt,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+		&expiresAt,
+		&confirmedAt,
+		&unsubscribedAt,
+	)
+	sub.ConfirmationExpiresAt = expiresAt.Time
+	sub.ConfirmedAt = confirmedAt.Time
+	sub.UnsubscribedAt = unsubscribedAt.Time
+	if err != nil {
+		return sub, err
+	}
+
+	sub.Email, err = open(cipher, email, keyID, ciphertext)
+	return sub, err
+}
+
+// RenewConfirmToken replaces the confirmation token of a pending
+// subscription, restarts its confirmation window and queues the message
+// built by confirmation in the same transaction, so links already sent
+// keep working unless the new one is queued. Only the latest confirmation
+// email works afterwards.
+func (ss *SubscriptionStore) RenewConfirmToken(
+	ctx context.Context,
+	email string,
+	city string,
+	frequency string,
+	confirmToken string,
+	expiresAt time.Time,
+	confirmation func(models.Subscription) (models.OutboxMessage, error),
+) (err error) {
+	query := `
+		UPDATE weather.subscriptions
+		SET confirm_token_hash = $4, previous_confirm_token_hash = NULL, confirmation_expires_at = $5,
+			reminder_sent_at = NULL, updated_at = now()
+		WHERE email_hash = $1 AND city = $2 AND frequency = $3 AND status = 'pending'
+		RETURNING ` + subscriptionColumns + `;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	row := tx.QueryRowContext(ctx, query, ss.cipher.BlindIndex(email), city, frequency, token.Hash(confirmToken), expiresAt)
+	sub, err := scanSubscription(row, ss.cipher)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return srverrors.ErrorNotFound
+		}
+		return errors.Wrap(err, "failed to renew confirmation token")
+	}
+	sub.ConfirmToken = confirmToken
+
+	msg, err := confirmation(sub)
+	if err != nil {
+		return err
+	}
+
+	if err = insertOutboxMessage(ctx, tx, ss.cipher, msg); err != nil {
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit confirmation token")
+}
+
+// transition moves the subscription matching the token hash (see tokenMatch) from
+// one of the given statuses to the status, applying extra assignments. When
+// nothing matches it tells an unknown token (srverrors.ErrorNotFound) from a
+// pending subscription past its confirmation window (srverrors.ErrorTokenExpired)
+// and from a status that doesn't allow the change (srverrors.ErrorInvalidTransition).
+func (ss *SubscriptionStore) transition(
+	ctx context.Context,
+	match string,
+	tokenHash string,
+	from []string,
+	to string,
+	set string,
+	event string,
+) (models.Subscription, error) {
+	allowed := make([]string, 0, len(from))
+	for _, status := range from {
+		if models.CanTransition(status, to) {
+			allowed = append(allowed, status)
+		}
+	}
+
+	query := withAudit(`
         UPDATE weather.subscriptions
-        SET confirmed = true
-        WHERE token = $1
-        RETURNING id, email, city, frequency, token;
+        SET status = $2, updated_at = now()`+set+`
+        WHERE `+match+`
+            AND status = ANY($3)
+            AND (status <> 'pending' OR confirmation_expires_at > now())`,
+		event,
+	)
+	stateQuery := `
+        SELECT status, COALESCE(status = 'pending' AND confirmation_expires_at <= now(), false)
+        FROM weather.subscriptions
+        WHERE ` + match + `
+        LIMIT 1;
     `
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	var sub models.Subscription
-	err := ss.db.
-		QueryRowContext(ctx, query, token).
-		Scan(&sub.ID, &sub.Email, &sub.City, &sub.Frequency, &sub.Token)
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, tokenHash, to, pq.Array(allowed)), ss.cipher)
+	if err == nil {
+		return sub, nil
+	}
+	if err != sql.ErrNoRows {
+		return models.Subscription{}, errors.Wrapf(err, "failed to change subscription status to %s", to)
+	}
+
+	var (
+		status  string
+		expired bool
+	)
+	err = ss.db.QueryRowContext(ctx, stateQuery, tokenHash).Scan(&status, &expired)
+	switch {
+	case err == sql.ErrNoRows:
+		return models.Subscription{}, srverrors.ErrorNotFound
+	case err != nil:
+		return models.Subscription{}, errors.Wrap(err, "failed to get subscription status")
+	case expired && slices.Contains(allowed, status):
+		return models.Subscription{}, srverrors.ErrorTokenExpired
+	default:
+		return models.Subscription{}, srverrors.ErrorInvalidTransition
+	}
+}
+
+// Confirm activates a pending subscription. The confirmation token is
+// single-use and is rejected with srverrors.ErrorTokenExpired once its
+// window has passed.
+func (ss *SubscriptionStore) Confirm(ctx context.Context, confirmToken string) (models.Subscription, error) {
+	return ss.transition(
+		ctx,
+		tokenMatch(true, confirmTokenColumns...),
+		token.Hash(confirmToken),
+		[]string{models.StatusPending},
+		models.StatusActive,
+		`, confirmed_at = now(), unsubscribed_at = NULL, confirm_token_hash = NULL, previous_confirm_token_hash = NULL,
+			confirmation_expires_at = NULL`,
+		models.EventConfirmed,
+	)
+}
+
+func (ss *SubscriptionStore) Unsubscribe(ctx context.Context, unsubscribeToken string) (models.Subscription, error) {
+	return ss.transition(
+		ctx,
+		tokenMatch(true, "unsubscribe_token_hash"),
+		token.Hash(unsubscribeToken),
+		[]string{models.StatusActive, models.StatusPaused},
+		models.StatusUnsubscribed,
+		`, unsubscribed_at = now()`,
+		models.EventUnsubscribed,
+	)
+}
 
+// Pause stops forecasts of an active subscription until it is resumed.
+func (ss *SubscriptionStore) Pause(ctx context.Context, unsubscribeToken string) (models.Subscription, error) {
+	return ss.transition(
+		ctx,
+		tokenMatch(false, "unsubscribe_token_hash"),
+		token.Hash(unsubscribeToken),
+		[]string{models.StatusActive},
+		models.StatusPaused,
+		``,
+		models.EventPaused,
+	)
+}
+
+func (ss *SubscriptionStore) Resume(ctx context.Context, unsubscribeToken string) (models.Subscription, error) {
+	return ss.transition(
+		ctx,
+		tokenMatch(false, "unsubscribe_token_hash"),
+		token.Hash(unsubscribeToken),
+		[]string{models.StatusPaused},
+		models.StatusActive,
+		``,
+		models.EventResumed,
+	)
+}
+
+// GetByToken returns the subscription the unsubscribe token was issued for.
+func (ss *SubscriptionStore) GetByToken(ctx context.Context, unsubscribeToken string) (models.Subscription, error) {
+	query := `
+        SELECT ` + subscriptionColumns + `
+        FROM weather.subscriptions
+        WHERE unsubscribe_token_hash = $1
+        LIMIT 1;
+    `
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, token.Hash(unsubscribeToken)), ss.cipher)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Subscription{}, srverrors.ErrorNotFound
 		}
-		return models.Subscription{}, errors.Wrap(err, "failed to confirm subscription")
+		return models.Subscription{}, errors.Wrap(err, "failed to get subscription")
 	}
 
 	return sub, nil
 }
 
-func (ss *SubscriptionStore) Unsubscribe(ctx context.Context, token string) (models.Subscription, error) {
-	const query = `
-        UPDATE weather.subscriptions
-        SET confirmed = false
-        WHERE token = $1
-        RETURNING id, email, city, frequency, token;
+// Update applies the changes to an active or paused subscription. Moving it
+// onto another active or paused subscription of the same email, city and
+// frequency is reported as srverrors.ErrorAlreadyExists; a pending,
+// unsubscribed or bounced one there is deleted in favour of the update.
+func (ss *SubscriptionStore) Update(
+	ctx context.Context,
+	unsubscribeToken string,
+	changes models.SubscriptionChanges,
+) (sub models.Subscription, err error) {
+	removeQuery := `
+        DELETE FROM weather.subscriptions s
+        USING weather.subscriptions t
+        WHERE t.unsubscribe_token_hash = $1
+            AND t.status = ANY($4)
+            AND s.id <> t.id
+            AND s.email_hash = t.email_hash
+            AND s.city = COALESCE($2, t.city)
+            AND s.frequency = COALESCE($3, t.frequency)
+            AND s.status <> ALL($4);
     `
+	query := withAudit(`
+        UPDATE weather.subscriptions
+        SET city = COALESCE($2, city),
+            frequency = COALESCE($3, frequency),
+            units = COALESCE($4, units),
+            language = COALESCE($5, language),
+            delivery_hour = COALESCE($6, delivery_hour),
+            updated_at = now()
+        WHERE unsubscribe_token_hash = $1
+            AND status = ANY($7)`,
+		models.EventUpdated,
+	)
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	var sub models.Subscription
-	err := ss.db.
-		QueryRowContext(ctx, query, token).
-		Scan(&sub.ID, &sub.Email, &sub.City, &sub.Frequency, &sub.Token)
+	tokenHash := token.Hash(unsubscribeToken)
+	updatable := pq.Array([]string{models.StatusActive, models.StatusPaused})
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Subscription{}, errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, removeQuery, tokenHash, changes.City, changes.Frequency, updatable); err != nil {
+		return models.Subscription{}, errors.Wrap(err, "failed to remove inactive subscription")
+	}
+
+	sub, err = scanSubscription(tx.QueryRowContext(
+		ctx,
+		query,
+		tokenHash,
+		changes.City,
+		changes.Frequency,
+		changes.Units,
+		changes.Language,
+		changes.DeliveryHour,
+		updatable,
+	), ss.cipher)
+	if err == nil {
+		if err = tx.Commit(); err != nil {
+			return models.Subscription{}, errors.Wrap(err, "failed to commit update")
+		}
+		return sub, nil
+	}
+
+	if pgErr, ok := err.(*pq.Error); ok {
+		if pgErr.Code == pgAlreadyExistsCode && pgErr.Constraint == pgAlreadyExistsConstraint {
+			return models.Subscription{}, srverrors.ErrorAlreadyExists
+		}
+	}
+	if err != sql.ErrNoRows {
+		return models.Subscription{}, errors.Wrap(err, "failed to update subscription")
+	}
+	if err = tx.Rollback(); err != nil {
+		return models.Subscription{}, errors.Wrap(err, "failed to rollback")
+	}
+
+	if _, err := ss.GetByToken(ctx, unsubscribeToken); err != nil {
+		return models.Subscription{}, err
+	}
+
+	return models.Subscription{}, srverrors.ErrorInvalidTransition
+}
 
+// Cancel deletes a subscription that was never confirmed.
+func (ss *SubscriptionStore) Cancel(ctx context.Context, confirmToken string) (models.Subscription, error) {
+	query := withAudit(`
+        DELETE FROM weather.subscriptions
+        WHERE `+tokenMatch(false, confirmTokenColumns...)+` AND status = 'pending'`,
+		models.EventCancelled,
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	sub, err := scanSubscription(ss.db.QueryRowContext(ctx, query, token.Hash(confirmToken)), ss.cipher)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return models.Subscription{}, srverrors.ErrorNotFound
 		}
-		return models.Subscription{}, errors.Wrap(err, "failed to unsubscribe")
+		return models.Subscription{}, errors.Wrap(err, "failed to cancel subscription")
 	}
 
 	return sub, nil
 }
+
+// AssignUnsubscribeSalts gives a salt and the matching unsubscribe token
+// to subscriptions created before tokens were randomized.
+func (ss *SubscriptionStore) AssignUnsubscribeSalts(
+	ctx context.Context,
+	unsubscribeToken func(salt string) string,
+) (assigned int, err error) {
+	const (
+		selectQuery = `SELECT id FROM weather.subscriptions WHERE unsubscribe_salt IS NULL;`
+		updateQuery = `
+			UPDATE weather.subscriptions
+			SET unsubscribe_salt = $2, unsubscribe_token_hash = $3
+			WHERE id = $1 AND unsubscribe_salt IS NULL;
+		`
+	)
+
+	rows, err := ss.db.QueryContext(ctx, selectQuery)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get subscriptions without salt")
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, joinErr.Join(errors.Wrap(err, "failed to scan subscription id"), rows.Close())
+		}
+		ids = append(ids, id)
+	}
+	if err := joinErr.Join(rows.Err(), rows.Close()); err != nil {
+		return 0, errors.Wrap(err, "row iteration error")
+	}
+
+	for _, id := range ids {
+		salt, err := token.Generate()
+		if err != nil {
+			return assigned, err
+		}
+
+		if _, err := ss.db.ExecContext(ctx, updateQuery, id, salt, token.Hash(unsubscribeToken(salt))); err != nil {
+			return assigned, errors.Wrap(err, "failed to assign unsubscribe salt")
+		}
+		assigned++
+	}
+
+	return assigned, nil
+}
+
+// PurgeExpired deletes pending subscriptions whose confirmation window has passed.
+func (ss *SubscriptionStore) PurgeExpired(ctx context.Context) (int64, error) {
+	const query = `
+		DELETE FROM weather.subscriptions
+		WHERE status = 'pending' AND confirmation_expires_at <= now();
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := ss.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge expired subscriptions")
+	}
+
+	purged, err := res.RowsAffected()
+	return purged, errors.Wrap(err, "failed to count purged subscriptions")
+}
+
+// GetUnreminded returns up to limit pending subscriptions expiring within
+// the given window that haven't been reminded yet, soonest first.
+func (ss *SubscriptionStore) GetUnreminded(
+	ctx context.Context,
+	within time.Duration,
+	limit int,
+) ([]models.Subscription, error) {
+	query := `
+		SELECT ` + subscriptionColumns + `
+		FROM weather.subscriptions
+		WHERE status = 'pending'
+			AND reminder_sent_at IS NULL
+			AND confirmation_expires_at > now()
+			AND confirmation_expires_at <= now() + make_interval(secs => $1)
+		ORDER BY confirmation_expires_at
+		LIMIT $2;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	subs, err := ss.query(ctx, query, within.Seconds(), limit)
+	return subs, errors.Wrap(err, "failed to get unreminded subscriptions")
+}
+
+// ListByEmail returns every subscription of the email, oldest first.
+func (ss *SubscriptionStore) ListByEmail(ctx context.Context, email string) ([]models.Subscription, error) {
+	query := `
+		SELECT ` + subscriptionColumns + `
+		FROM weather.subscriptions
+		WHERE email_hash = $1
+		ORDER BY created_at, id;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	subs, err := ss.query(ctx, query, ss.cipher.BlindIndex(email))
+	return subs, errors.Wrap(err, "failed to list subscriptions")
+}
+
+// List returns the subscriptions matching the filter, oldest first.
+// Cities match case-insensitively.
+func (ss *SubscriptionStore) List(ctx context.Context, filter models.SubscriptionFilter) ([]models.Subscription, error) {
+	query := `
+		SELECT ` + subscriptionColumns + `
+		FROM weather.subscriptions
+		WHERE ($1 = '' OR status::text = $1)
+			AND ($2 = '' OR lower(city) = lower($2))
+			AND ($3 = '' OR frequency::text = $3)
+		ORDER BY created_at, id;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, ListTimeoutDuration)
+	defer cancel()
+
+	subs, err := ss.query(ctx, query, filter.Status, filter.City, filter.Frequency)
+	return subs, errors.Wrap(err, "failed to list subscriptions")
+}
+
+// Import stores subscriptions confirmed elsewhere, e.g. by a previous
+// system, with the unsubscribe tokens set by the caller. Subscriptions of
+// an existing email, city and frequency are skipped. It returns the
+// imported subscriptions.
+func (ss *SubscriptionStore) Import(ctx context.Context, subs []models.Subscription) (imported []models.Subscription, err error) {
+	const query = `
+		INSERT INTO weather.subscriptions (
+			email_hash, email_ciphertext, email_key_id, city, frequency, language, units, delivery_hour,
+			status, unsubscribe_token_hash, unsubscribe_salt, confirmed_at, unsubscribed_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, COALESCE($12, now()),
+			CASE WHEN $9 = 'unsubscribed' THEN COALESCE($13, now()) END)
+		ON CONFLICT (email_hash, city, frequency) DO NOTHING
+		RETURNING id, created_at, updated_at;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, ListTimeoutDuration)
+	defer cancel()
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	for _, sub := range subs {
+		email, err := seal(ss.cipher, sub.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		confirmedAt := sql.NullTime{Time: sub.ConfirmedAt, Valid: !sub.ConfirmedAt.IsZero()}
+		unsubscribedAt := sql.NullTime{Time: sub.UnsubscribedAt, Valid: !sub.UnsubscribedAt.IsZero()}
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			email.hash,
+			email.ciphertext,
+			email.keyID,
+			sub.City,
+			sub.Frequency,
+			sub.Language,
+			sub.Units,
+			sub.DeliveryHour,
+			sub.Status,
+			token.Hash(sub.UnsubscribeToken),
+			sub.UnsubscribeSalt,
+			confirmedAt,
+			unsubscribedAt,
+		).Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to import subscription to %s", sub.City)
+		}
+
+		if err = insertAuditEvent(ctx, tx, email.hash, sub.ID, models.EventImported); err != nil {
+			return nil, err
+		}
+		imported = append(imported, sub)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to commit import")
+	}
+
+	return imported, nil
+}
+
+// UnsubscribeByEmail unsubscribes the active and paused subscriptions of
+// the email with the given IDs, or all of them when no IDs are given.
+// IDs of other emails are ignored.
+func (ss *SubscriptionStore) UnsubscribeByEmail(
+	ctx context.Context,
+	email string,
+	ids []int64,
+) ([]models.Subscription, error) {
+	query := withAudit(`
+		UPDATE weather.subscriptions
+		SET status = $2, updated_at = now(), unsubscribed_at = now()
+		WHERE email_hash = $1
+			AND status = ANY($3)
+			AND (COALESCE(cardinality($4::bigint[]), 0) = 0 OR id = ANY($4))`,
+		models.EventUnsubscribed,
+	)
+
+	var from []string
+	for _, status := range []string{models.StatusActive, models.StatusPaused} {
+		if models.CanTransition(status, models.StatusUnsubscribed) {
+			from = append(from, status)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	subs, err := ss.query(ctx, query, ss.cipher.BlindIndex(email), models.StatusUnsubscribed, pq.Array(from), pq.Array(ids))
+	return subs, errors.Wrap(err, "failed to unsubscribe subscriptions")
+}
+
+// query runs a query returning subscriptionColumns.
+func (ss *SubscriptionStore) query(ctx context.Context, query string, args ...any) (subs []models.Subscription, err error) {
+	rows, err := ss.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		closeErr := rows.Close()
+		if closeErr != nil {
+			closeErr = errors.Wrap(closeErr, "failed to close rows")
+			if err != nil {
+				err = joinErr.Join(err, closeErr)
+			} else {
+				err = closeErr
+			}
+		}
+	}()
+
+	for rows.Next() {
+		sub, err := scanSubscription(rows, ss.cipher)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to scan subscription row")
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "row iteration error")
+	}
+
+	return subs, nil
+}
+
+// MarkReminded stores the new confirmation token carried by the reminder
+// and queues the reminder in the same transaction. The token sent before
+// stays valid, so the first confirmation email keeps working.
+func (ss *SubscriptionStore) MarkReminded(
+	ctx context.Context,
+	sub models.Subscription,
+	reminder models.OutboxMessage,
+) (err error) {
+	const query = `
+		UPDATE weather.subscriptions
+		SET previous_confirm_token_hash = confirm_token_hash, confirm_token_hash = $2, reminder_sent_at = now()
+		WHERE id = $1 AND status = 'pending' AND reminder_sent_at IS NULL;
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+				err = joinErr.Join(err, errors.Wrap(rollbackErr, "failed to rollback"))
+			}
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, query, sub.ID, token.Hash(sub.ConfirmToken))
+	if err != nil {
+		return errors.Wrap(err, "failed to mark subscription as reminded")
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "failed to mark subscription as reminded")
+	}
+	if affected == 0 {
+		// Confirmed or reminded by another replica in the meantime.
+		return srverrors.ErrorNotFound
+	}
+
+	if err = insertOutboxMessage(ctx, tx, ss.cipher, reminder); err != nil {
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit reminder")
+}
@@ -0,0 +1,111 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Size is the number of random bytes in a generated token.
+const Size = 32
+
+// placeholderSecret is the value example configurations used to ship.
+const placeholderSecret = "change-me"
+
+var (
+	ErrEmptySecret       = errors.New("token secret is empty")
+	ErrPlaceholderSecret = errors.New("token secret is the example placeholder")
+	ErrInvalid           = errors.New("token is invalid")
+	ErrExpired           = errors.New("token has expired")
+)
+
+// Generate returns a random URL-safe token.
+func Generate() (string, error) {
+	buf := make([]byte, Size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "unable to generate token")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Hash returns the form a token is stored in. Tokens carry enough entropy
+// for a plain SHA-256 to be irreversible.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Signer derives tokens from a server secret, so that they can be
+// recreated at any time without being stored.
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret string) (*Signer, error) {
+	if secret == "" {
+		return nil, ErrEmptySecret
+	}
+	if secret == placeholderSecret {
+		return nil, ErrPlaceholderSecret
+	}
+
+	return &Signer{secret: []byte(secret)}, nil
+}
+
+// Sign returns the URL-safe HMAC-SHA256 of the value.
+func (s *Signer) Sign(value string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(value))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Unsubscribe derives the unsubscribe token of a subscription from its salt.
+// Replacing the salt revokes every unsubscribe link sent so far.
+func (s *Signer) Unsubscribe(salt string) string {
+	return s.Sign("unsubscribe:" + salt)
+}
+
+// Issue returns a token carrying the subject until it expires. The subject
+// is readable by the token holder. Tokens are bound to their purpose, so
+// one issued for a purpose is rejected for any other.
+func (s *Signer) Issue(purpose, subject string, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(strconv.FormatInt(expiresAt.Unix(), 10) + ":" + subject),
+	)
+
+	return payload + "." + s.Sign(purpose+":"+payload)
+}
+
+// Verify returns the subject of a token issued for the purpose.
+func (s *Signer) Verify(purpose, value string) (string, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.Sign(purpose+":"+payload))) {
+		return "", ErrInvalid
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalid
+	}
+
+	expiry, subject, ok := strings.Cut(string(decoded), ":")
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if !ok || err != nil {
+		return "", ErrInvalid
+	}
+
+	if time.Now().Unix() >= expiresAt {
+		return "", ErrExpired
+	}
+
+	return subject, nil
+}
@@ -0,0 +1,120 @@
+package token
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSigner(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr error
+	}{
+		{name: "secret", secret: "s3cr3t-value"},
+		{name: "empty", secret: "", wantErr: ErrEmptySecret},
+		{name: "placeholder", secret: placeholderSecret, wantErr: ErrPlaceholderSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSigner(tt.secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewSigner error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIssueVerify(t *testing.T) {
+	signer, err := NewSigner("s3cr3t-value")
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	other, err := NewSigner("another-secret")
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+
+	valid := signer.Issue("login", "user@example.com", time.Now().Add(time.Hour))
+	payload, signature, _ := strings.Cut(valid, ".")
+
+	tests := []struct {
+		name        string
+		purpose     string
+		token       string
+		wantSubject string
+		wantErr     error
+	}{
+		{name: "valid", purpose: "login", token: valid, wantSubject: "user@example.com"},
+		{
+			name:        "subject with colons",
+			purpose:     "session",
+			token:       signer.Issue("session", "3:user@example.com", time.Now().Add(time.Hour)),
+			wantSubject: "3:user@example.com",
+		},
+		{
+			name:    "expired",
+			purpose: "login",
+			token:   signer.Issue("login", "user@example.com", time.Now().Add(-time.Second)),
+			wantErr: ErrExpired,
+		},
+		{name: "other purpose", purpose: "session", token: valid, wantErr: ErrInvalid},
+		{
+			name:    "other secret",
+			purpose: "login",
+			token:   other.Issue("login", "user@example.com", time.Now().Add(time.Hour)),
+			wantErr: ErrInvalid,
+		},
+		{name: "tampered payload", purpose: "login", token: "x" + payload + "." + signature, wantErr: ErrInvalid},
+		{name: "tampered signature", purpose: "login", token: payload + ".x" + signature, wantErr: ErrInvalid},
+		{name: "no signature", purpose: "login", token: payload, wantErr: ErrInvalid},
+		{name: "empty", purpose: "login", token: "", wantErr: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, err := signer.Verify(tt.purpose, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.wantErr)
+			}
+			if subject != tt.wantSubject {
+				t.Errorf("Verify subject = %q, want %q", subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	signer, err := NewSigner("s3cr3t-value")
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+
+	if signer.Unsubscribe("salt") != signer.Unsubscribe("salt") {
+		t.Error("Unsubscribe isn't deterministic")
+	}
+	if signer.Unsubscribe("salt") == signer.Unsubscribe("other salt") {
+		t.Error("Unsubscribe ignores the salt")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	first, err := Generate()
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	second, err := Generate()
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	if first == second {
+		t.Error("Generate returned the same token twice")
+	}
+	if len(Hash(first)) != 64 {
+		t.Errorf("Hash length = %d, want 64", len(Hash(first)))
+	}
+}
@@ -11,14 +11,32 @@ type APIInterface interface {
 
 type RemoteService struct {
 	remote APIInterface
+	cache  *Cache
 }
 
 func (rs *RemoteService) GetCityWeather(ctx context.Context, city string) (models.Weather, error) {
-	return rs.remote.GetCityWeather(ctx, city)
+	if weather, ok := rs.cache.Get(city); ok {
+		return weather, nil
+	}
+
+	return rs.Refresh(ctx, city)
+}
+
+// Refresh bypasses the cache, fetches the city weather and stores it.
+func (rs *RemoteService) Refresh(ctx context.Context, city string) (models.Weather, error) {
+	weather, err := rs.remote.GetCityWeather(ctx, city)
+	if err != nil {
+		return models.Weather{}, err
+	}
+
+	rs.cache.Set(city, weather)
+
+	return weather, nil
 }
 
-func NewRemoteService(api APIInterface) *RemoteService {
+func NewRemoteService(api APIInterface, cache *Cache) *RemoteService {
 	return &RemoteService{
 		remote: api,
+		cache:  cache,
 	}
 }
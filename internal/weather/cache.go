@@ -0,0 +1,74 @@
+package weather
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"weather/internal/models"
+)
+
+type cacheEntry struct {
+	weather   models.Weather
+	expiresAt time.Time
+}
+
+// Cache keeps recently fetched weather per normalized city name.
+// A nil *Cache is valid and never stores anything.
+type Cache struct {
+	mx      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+func NewCache(ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &Cache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func NormalizeCity(city string) string {
+	return strings.ToLower(strings.Join(strings.Fields(city), " "))
+}
+
+func (c *Cache) Get(city string) (models.Weather, bool) {
+	if c == nil {
+		return models.Weather{}, false
+	}
+
+	c.mx.RLock()
+	entry, ok := c.entries[NormalizeCity(city)]
+	c.mx.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		return models.Weather{}, false
+	}
+
+	return entry.weather, true
+}
+
+func (c *Cache) Set(city string, weather models.Weather) {
+	if c == nil {
+		return
+	}
+
+	now := time.Now()
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.entries[NormalizeCity(city)] = cacheEntry{
+		weather:   weather,
+		expiresAt: now.Add(c.ttl),
+	}
+}